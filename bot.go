@@ -0,0 +1,349 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/go-co-op/gocron/v2"
+)
+
+// Clock is where the bot gets the time from, swapped out in tests.
+type Clock interface {
+    Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+    return time.Now()
+}
+
+// DiscordPoster is the part of *discordgo.Session used to post items, answer commands
+// and register them.
+type DiscordPoster interface {
+    ForumThreadStart(channelID, name string, archiveDuration int, content string, options ...discordgo.RequestOption) (*discordgo.Channel, error)
+    ForumThreadStartComplex(channelID string, threadData *discordgo.ThreadStart, messageData *discordgo.MessageSend, options ...discordgo.RequestOption) (*discordgo.Channel, error)
+    ChannelMessageSend(channelID string, content string, options ...discordgo.RequestOption) (*discordgo.Message, error)
+    InteractionRespond(interaction *discordgo.Interaction, resp *discordgo.InteractionResponse, options ...discordgo.RequestOption) error
+    InteractionResponseEdit(interaction *discordgo.Interaction, newresp *discordgo.WebhookEdit, options ...discordgo.RequestOption) (*discordgo.Message, error)
+    FollowupMessageCreate(interaction *discordgo.Interaction, wait bool, data *discordgo.WebhookParams, options ...discordgo.RequestOption) (*discordgo.Message, error)
+    ApplicationCommandCreate(appID string, guildID string, cmd *discordgo.ApplicationCommand, options ...discordgo.RequestOption) (*discordgo.ApplicationCommand, error)
+    ApplicationCommandDelete(appID, guildID, cmdID string, options ...discordgo.RequestOption) error
+    ApplicationCommands(appID, guildID string, options ...discordgo.RequestOption) ([]*discordgo.ApplicationCommand, error)
+}
+
+// FeedFetcher sends feed requests, *FeedClient is the real one.
+type FeedFetcher interface {
+    Do(req *http.Request) (*http.Response, error)
+    ReadBody(resp *http.Response) ([]byte, error)
+}
+
+// Bot owns the config, connections and feed watchers that used to be package globals.
+type Bot struct {
+    config atomic.Pointer[Config]
+    discord DiscordPoster
+    fetcher FeedFetcher
+    clock Clock
+    store StateStore
+    schdl gocron.Scheduler
+    // mu guards feeds, which a reload replaces.
+    mu sync.RWMutex
+    feeds []*FeedWatcher
+    // session and registered are only set by Run, everything else goes through discord.
+    session *discordgo.Session
+    registered map[string][]*discordgo.ApplicationCommand
+    // appID is the bot user's id, which commands are registered under. Set once connected.
+    appID string
+    connected atomic.Bool
+    ready atomic.Bool
+}
+
+// NewBot builds a watcher and a scheduler job for every configured feed.
+// Nothing is fetched or posted until Run or a command asks for it.
+func NewBot(cfg *Config, discord DiscordPoster, fetcher FeedFetcher, clock Clock, store StateStore) (*Bot, error) {
+    schdl, err := gocron.NewScheduler()
+    if err != nil {
+        return nil, fmt.Errorf("initializing scheduler: %w", err)
+    }
+    b := &Bot{
+        discord: discord,
+        fetcher: fetcher,
+        clock: clock,
+        store: store,
+        schdl: schdl,
+        feeds: make([]*FeedWatcher, 0, len(cfg.Feeds)),
+    }
+    b.config.Store(cfg)
+    for x := range cfg.Feeds {
+        fw, err := NewFeedWatcher(b, &cfg.Feeds[x], cfg.TargetsFor(&cfg.Feeds[x]))
+        if err != nil {
+            return nil, fmt.Errorf("setting up feed '%s': %w", cfg.Feeds[x].Name, err)
+        }
+        err = b.scheduleFeed(fw)
+        if err != nil {
+            return nil, err
+        }
+        b.feeds = append(b.feeds, fw)
+    }
+    return b, nil
+}
+
+// scheduleFeed adds the feed's cron job, or updates it in place once it has one.
+func (b *Bot) scheduleFeed(fw *FeedWatcher) error {
+    definition := gocron.CronJob(fw.Config().CronSchedule, true)
+    task := gocron.NewTask(fw.onCronCallback)
+    options := []gocron.JobOption{
+        gocron.WithName(fw.Name()),
+        gocron.WithSingletonMode(gocron.LimitModeReschedule),
+    }
+    var err error
+    if fw.job == nil {
+        fw.job, err = b.schdl.NewJob(definition, task, options...)
+    } else {
+        _, err = b.schdl.Update(fw.job.ID(), definition, task, options...)
+    }
+    if err != nil {
+        return fmt.Errorf("scheduling feed '%s': %w", fw.Name(), err)
+    }
+    return nil
+}
+
+func (b *Bot) Config() *Config {
+    return b.config.Load()
+}
+
+// Feeds is a snapshot of the running feeds.
+func (b *Bot) Feeds() []*FeedWatcher {
+    b.mu.RLock()
+    defer b.mu.RUnlock()
+    return b.feeds
+}
+
+// Run connects the session, registers the commands and runs the feeds until interrupted.
+// The config at configPath is reloaded when it changes or on SIGHUP.
+func (b *Bot) Run(session *discordgo.Session, configPath string) error {
+    b.session = session
+    session.AddHandler(func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+        b.HandleInteraction(i)
+    })
+    session.AddHandler(b.onReady)
+    session.AddHandler(func(s *discordgo.Session, _ *discordgo.Connect) {
+        b.connected.Store(true)
+    })
+    session.AddHandler(func(s *discordgo.Session, _ *discordgo.Disconnect) {
+        b.connected.Store(false)
+    })
+    session.Identify.Intents = discordgo.IntentsGuildMessages
+
+    if b.Config().StatusServer.Listen != "" {
+        b.StartStatusServer(b.Config().StatusServer.Listen)
+    }
+    err := b.connectToDiscordWithRetry()
+    if err != nil {
+        return fmt.Errorf("opening connection after retries: %w", err)
+    }
+    defer session.Close()
+    logLvlLn(LogDebug, "Discord Connected!")
+    b.appID = session.State.User.ID
+    b.registered, err = b.UpDiscord()
+    if err != nil {
+        return err
+    }
+
+    for _, fw := range b.Feeds() {
+        if err := fw.Init(); err != nil {
+            return err
+        }
+    }
+
+    b.schdl.Start()
+    logLvlLn(LogDebug, "Cron Scheduler Started.")
+    defer b.schdl.Shutdown()
+    b.ready.Store(true)
+
+    logLvlLn(LogProd, "Bot is now running. Press CTRL-C to exit.")
+    sc := make(chan os.Signal, 1)
+    signal.Notify(sc, syscall.SIGINT, syscall.SIGTERM, os.Interrupt, syscall.SIGHUP)
+    stop := make(chan struct{})
+    defer close(stop)
+    changed := watchFile(configPath, configWatchInterval, stop)
+    for {
+        select {
+        case sig := <-sc:
+            if sig == syscall.SIGHUP {
+                logLvlLn(LogProd, "Got SIGHUP, reloading config.")
+                b.reloadOrKeep(configPath)
+                continue
+            }
+        case <-changed:
+            logLvlLn(LogProd, "Config file changed, reloading.")
+            b.reloadOrKeep(configPath)
+            continue
+        }
+        break
+    }
+
+    b.ready.Store(false)
+    return b.DownDiscord(b.registered)
+}
+
+// HandleInteraction runs the slash command handler for an interaction.
+func (b *Bot) HandleInteraction(i *discordgo.InteractionCreate) {
+    if i.Type != discordgo.InteractionApplicationCommand {
+        return
+    }
+    name := i.ApplicationCommandData().Name
+    if h, ok := commandHandlers[name]; ok {
+        if denied := b.checkPermissions(name, i); denied != "" {
+            logCmd(name, i, denied)
+            err := b.respondWithFlags(i, denied, discordgo.MessageFlagsEphemeral)
+            if err != nil {
+                logLvlLn(LogProd, "Error "+name, err)
+            }
+            return
+        }
+        logCmd(name, i, "")
+        metricCommands.Inc(name)
+        err := h(b, i)
+        if err != nil {
+            logLvlLn(LogProd, "Error "+name, err)
+        }
+    }
+}
+
+func (b *Bot) onReady(s *discordgo.Session, event *discordgo.Ready) {
+    logLvlF(LogProd, "Logged in as %s", event.User.String())
+    _ = s.UpdateGameStatus(0, b.Config().DiscordBot.Status)
+}
+
+func (b *Bot) connectToDiscordWithRetry() error {
+    retryDelay := 5 * time.Second // Base delay between retries
+    for attempt := 0; attempt <= b.Config().DiscordBot.Retries; attempt++ {
+        err := b.session.Open()
+        if err == nil {
+            return nil
+        }
+
+        logLvlF(LogDebug, "Connection attempt %d/%d failed: %v", attempt+1, b.Config().DiscordBot.Retries, err)
+
+        if attempt < b.Config().DiscordBot.Retries {
+            // Exponential backoff: 5s, 10s, 20s, etc.
+            sleepTime := retryDelay * time.Duration(1<<uint(attempt))
+            logLvlF(LogDebug, "Waiting %v before next attempt...", sleepTime)
+            time.Sleep(sleepTime)
+        }
+    }
+    return fmt.Errorf("failed to connect to Discord after %d retries", b.Config().DiscordBot.Retries)
+}
+
+// UpDiscord registers the commands in every configured guild, or once globally,
+// and returns what was registered keyed by guild id.
+func (b *Bot) UpDiscord() (map[string][]*discordgo.ApplicationCommand, error) {
+    registeredCommands := make(map[string][]*discordgo.ApplicationCommand)
+    if b.Config().GlobalCommands {
+        cmds, err := b.registerCommands("", b.Feeds())
+        if err != nil {
+            return registeredCommands, err
+        }
+        registeredCommands[""] = cmds
+    } else {
+        for _, guild := range b.Config().Guilds {
+            cmds, err := b.registerCommands(guild.GuildID, b.guildFeeds(&guild))
+            if err != nil {
+                return registeredCommands, err
+            }
+            registeredCommands[guild.GuildID] = cmds
+        }
+    }
+    logLvlLn(LogProd, "Registered Discord Commands")
+    return registeredCommands, nil
+}
+
+func (b *Bot) registerCommands(guildID string, guildFeeds []*FeedWatcher) ([]*discordgo.ApplicationCommand, error) {
+    // Past discord's limit the feed is typed in instead, the handlers check it either way.
+    var choices []*discordgo.ApplicationCommandOptionChoice
+    if len(guildFeeds) <= maxCommandChoices {
+        for _, fw := range guildFeeds {
+            choices = append(choices, &discordgo.ApplicationCommandOptionChoice{
+                Name: fw.Name(),
+                Value: fw.Name(),
+            })
+        }
+    }
+    registeredCommands := make([]*discordgo.ApplicationCommand, len(commands))
+    for i, v := range commands {
+        v = scopedCommand(v, choices, b.Config().CommandPermissions(v.Name).DefaultMemberPermissions)
+        cmd, err := b.discord.ApplicationCommandCreate(b.appID, guildID, v)
+        if err != nil {
+            return registeredCommands, fmt.Errorf("cannot create '%v' command in '%s': %w", v.Name, guildID, err)
+        }
+        registeredCommands[i] = cmd
+    }
+    return registeredCommands, nil
+}
+
+// scopedCommand copies a command with the feed choices and permissions of one scope,
+// leaving the shared definition in commands alone.
+func scopedCommand(cmd *discordgo.ApplicationCommand, choices []*discordgo.ApplicationCommandOptionChoice, permissions *int64) *discordgo.ApplicationCommand {
+    scoped := *cmd
+    scoped.DefaultMemberPermissions = permissions
+    scoped.Options = make([]*discordgo.ApplicationCommandOption, len(cmd.Options))
+    for x, opt := range cmd.Options {
+        option := *opt
+        if option.Name == "feed" {
+            option.Choices = choices
+        }
+        scoped.Options[x] = &option
+    }
+    return &scoped
+}
+
+func (b *Bot) DownDiscord(registeredCommands map[string][]*discordgo.ApplicationCommand) error {
+    if !b.Config().RemoveCommands {
+        return nil
+    }
+    logLvlLn(LogProd, "Removing commands...")
+    for guildID, cmds := range registeredCommands {
+        if err := b.deleteCommands(guildID, cmds); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func (b *Bot) deleteCommands(guildID string, cmds []*discordgo.ApplicationCommand) error {
+    for _, v := range cmds {
+        err := b.discord.ApplicationCommandDelete(b.appID, guildID, v.ID)
+        if err != nil {
+            return fmt.Errorf("cannot delete '%v' command in '%s': %w", v.Name, guildID, err)
+        }
+    }
+    return nil
+}
+
+// guildFeeds lists the feeds the guild is subscribed to.
+func (b *Bot) guildFeeds(guild *GuildConfig) []*FeedWatcher {
+    result := make([]*FeedWatcher, 0, len(b.Feeds()))
+    for _, fw := range b.Feeds() {
+        if guild.HasFeed(fw.Name()) {
+            result = append(result, fw)
+        }
+    }
+    return result
+}
+
+func (b *Bot) FindFeed(name string) *FeedWatcher {
+    for _, fw := range b.Feeds() {
+        if fw.Name() == name {
+            return fw
+        }
+    }
+    return nil
+}
@@ -0,0 +1,420 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// subcommand is a one-shot job run from the shell with the bot's config, instead of the bot itself.
+type subcommand struct {
+    usage string
+    summary string
+    run func(fs *flag.FlagSet, configPath *string, args []string) error
+}
+
+var subcommands = map[string]subcommand{
+    "fetch": {
+        usage: "fetch [-feed name] [-count n]",
+        summary: "Print the items in each feed and whether they were posted.",
+        run: cliFetch,
+    },
+    "post": {
+        usage: "post -guid guid [-feed name] [-guild id] | post -new [-feed name]",
+        summary: "Post one item, or every new item like a scheduled check, to the subscribed guilds and exit.",
+        run: cliPost,
+    },
+    "state": {
+        usage: "state dump [-feed name] | state import [file]",
+        summary: "Print the saved state as json, or save state from a json file or stdin.",
+        run: cliState,
+    },
+    "commands": {
+        usage: "commands register | commands unregister",
+        summary: "Create or delete the slash commands without running the bot.",
+        run: cliCommands,
+    },
+}
+
+// runSubcommand runs os.Args[1] when it names a subcommand, and reports whether it did.
+func runSubcommand() bool {
+    if len(os.Args) < 2 {
+        return false
+    }
+    sub, ok := subcommands[os.Args[1]]
+    if !ok {
+        return false
+    }
+    fs, configPath := newFlagSet(os.Args[1], sub)
+    err := sub.run(fs, configPath, os.Args[2:])
+    if errors.Is(err, flag.ErrHelp) {
+        return true
+    }
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "%s: %v\n", os.Args[1], err)
+        os.Exit(1)
+    }
+    return true
+}
+
+// newFlagSet starts a subcommand's flags with the -config flag every one of them takes.
+func newFlagSet(name string, sub subcommand) (*flag.FlagSet, *string) {
+    fs := flag.NewFlagSet(name, flag.ContinueOnError)
+    configPath := fs.String("config", "env.toml", "Path to the configuration file")
+    fs.Usage = func() {
+        fmt.Fprintf(fs.Output(), "Usage: %s %s\n%s\n\n", os.Args[0], sub.usage, sub.summary)
+        fs.PrintDefaults()
+    }
+    return fs, configPath
+}
+
+// openBot builds the bot from the config the way main does, without connecting to discord.
+// Closing the bot's store is left to the caller.
+func openBot(config *Config) (*Bot, *discordgo.Session, error) {
+    logLevel = config.DiscordBot.Logging
+    session, err := discordgo.New("Bot " + config.DiscordBot.Token)
+    if err != nil {
+        return nil, nil, fmt.Errorf("creating discordgo session: %w", err)
+    }
+    store, err := NewStateStore(config.State.Type, config.State.Path)
+    if err != nil {
+        return nil, nil, fmt.Errorf("opening state store: %w", err)
+    }
+    bot, err := NewBot(config, session, NewFeedClient(config), realClock{}, store)
+    if err != nil {
+        store.Close()
+        return nil, nil, err
+    }
+    return bot, session, nil
+}
+
+// withBot loads the config, runs fn with a bot built from it and closes the store after.
+func withBot(configPath string, fn func(b *Bot, session *discordgo.Session) error) error {
+    config, err := LoadConfig(configPath)
+    if err != nil {
+        return err
+    }
+    b, session, err := openBot(config)
+    if err != nil {
+        return err
+    }
+    err = fn(b, session)
+    if closeErr := b.store.Close(); err == nil {
+        err = closeErr
+    }
+    return err
+}
+
+// selectFeeds is every feed, or just the named one.
+func (b *Bot) selectFeeds(name string) ([]*FeedWatcher, error) {
+    if name == "" {
+        return b.Feeds(), nil
+    }
+    fw := b.FindFeed(name)
+    if fw == nil {
+        return nil, fmt.Errorf("unknown feed '%s'", name)
+    }
+    return []*FeedWatcher{fw}, nil
+}
+
+func cliFetch(fs *flag.FlagSet, configPath *string, args []string) error {
+    feedName := fs.String("feed", "", "Only fetch this feed")
+    count := fs.Int("count", 0, "Number of items to print per feed, 0 for all of them")
+    if err := fs.Parse(args); err != nil {
+        return err
+    }
+    return withBot(*configPath, func(b *Bot, _ *discordgo.Session) error {
+        feeds, err := b.selectFeeds(*feedName)
+        if err != nil {
+            return err
+        }
+        var errs []error
+        for _, fw := range feeds {
+            if err := printFeed(os.Stdout, fw, *count); err != nil {
+                errs = append(errs, fmt.Errorf("feed '%s': %w", fw.Name(), err))
+            }
+        }
+        return errors.Join(errs...)
+    })
+}
+
+// printFeed lists the feed's items with their visited status, like /checkfeed.
+func printFeed(w io.Writer, fw *FeedWatcher, count int) error {
+    saved, err := fw.loadState()
+    if err != nil {
+        return err
+    }
+    feed, _, err := fw.CheckFeed()
+    if err != nil {
+        return err
+    }
+    fmt.Fprintf(w, "[%s] %s, %d items\n", fw.Name(), redactURL(fw.Config().Url), len(feed.Items))
+    if !saved {
+        fmt.Fprintln(w, "No saved state, the first run marks every item here as skipped.")
+    }
+    for x, item := range feed.Items {
+        if count > 0 && x >= count {
+            fmt.Fprintf(w, "%d more...\n", len(feed.Items)-count)
+            break
+        }
+        status := "new"
+        if val, found := fw.state.Visited(item.GUID); found {
+            switch val {
+            case VisitedPosted:
+                status = "posted"
+            case VisitedInit:
+                status = "skipped"
+            case VisitedSeen:
+                status = "pending"
+            case VisitedFiltered:
+                status = "filtered"
+            }
+        }
+        published := ""
+        if item.PublishedParsed != nil {
+            published = item.PublishedParsed.Format(fw.Config().DiscordMsg.TimeFormat)
+        }
+        fmt.Fprintf(w, "%3d. %-8s %s %s (%s)\n", x, status, published, item.Title, item.GUID)
+    }
+    return nil
+}
+
+func cliPost(fs *flag.FlagSet, configPath *string, args []string) error {
+    guid := fs.String("guid", "", "GUID of the item to post")
+    feedName := fs.String("feed", "", "Feed the item is in, all of them are searched by default")
+    guildID := fs.String("guild", "", "Only post to this guild")
+    postNew := fs.Bool("new", false, "Post every new item, for running the check from an external cron instead of the scheduler")
+    if err := fs.Parse(args); err != nil {
+        return err
+    }
+    if *postNew {
+        if *guid != "" || *guildID != "" {
+            fs.Usage()
+            return errors.New("-new posts to every subscribed guild and can't be used with -guid or -guild")
+        }
+        return withBot(*configPath, func(b *Bot, _ *discordgo.Session) error {
+            feeds, err := b.selectFeeds(*feedName)
+            if err != nil {
+                return err
+            }
+            var errs []error
+            for _, fw := range feeds {
+                if err := cliPostNew(fw); err != nil {
+                    errs = append(errs, fmt.Errorf("feed '%s': %w", fw.Name(), err))
+                }
+            }
+            return errors.Join(errs...)
+        })
+    }
+    if *guid == "" {
+        fs.Usage()
+        return errors.New("-guid or -new is required")
+    }
+    return withBot(*configPath, func(b *Bot, _ *discordgo.Session) error {
+        feeds, err := b.selectFeeds(*feedName)
+        if err != nil {
+            return err
+        }
+        for _, fw := range feeds {
+            targets := fw.Targets()
+            if *guildID != "" {
+                targets = slices.DeleteFunc(slices.Clone(targets), func(t PostTarget) bool {
+                    return t.GuildID != *guildID
+                })
+            }
+            if len(targets) == 0 {
+                continue
+            }
+            // Init first so a feed without saved state isn't reposted in full by the next bot run.
+            if err := fw.Init(); err != nil {
+                return err
+            }
+            result, err := fw.PostItem(*guid, targets)
+            if err != nil {
+                return fmt.Errorf("feed '%s': %w", fw.Name(), err)
+            }
+            if result == nil {
+                continue
+            }
+            fmt.Print(postResultLine(*result))
+            return result.Err
+        }
+        return fmt.Errorf("no feed subscribed to by the selected guilds has an item '%s'", *guid)
+    })
+}
+
+// cliPostNew does what the feed's scheduled check does, Init stands in for the bot's startup.
+// A feed without saved state posts nothing on its first run, like the bot.
+func cliPostNew(fw *FeedWatcher) error {
+    if err := fw.Init(); err != nil {
+        return err
+    }
+    if fw.inPostInterval() {
+        fmt.Printf("[%s] Skipped, the last post was less than %d hours ago.\n", fw.Name(), fw.Config().PostInterval)
+        return nil
+    }
+    results, err := fw.PostNew(nil)
+    if err != nil {
+        return err
+    }
+    if len(results) == 0 {
+        fmt.Printf("[%s] Nothing new to post.\n", fw.Name())
+    }
+    var errs []error
+    for _, result := range results {
+        fmt.Printf("[%s] %s", fw.Name(), postResultLine(result))
+        if result.Err != nil {
+            errs = append(errs, result.Err)
+        }
+    }
+    return errors.Join(errs...)
+}
+
+func cliState(fs *flag.FlagSet, configPath *string, args []string) error {
+    if len(args) == 0 {
+        fs.Usage()
+        return errors.New("expected dump or import")
+    }
+    switch args[0] {
+    case "dump":
+        return cliStateDump(fs, configPath, args[1:])
+    case "import":
+        return cliStateImport(fs, configPath, args[1:])
+    }
+    fs.Usage()
+    return fmt.Errorf("unknown state command '%s', expected dump or import", args[0])
+}
+
+// cliStateDump prints the saved state keyed by feed name, the same layout as a json state file.
+func cliStateDump(fs *flag.FlagSet, configPath *string, args []string) error {
+    feedName := fs.String("feed", "", "Only dump this feed")
+    if err := fs.Parse(args); err != nil {
+        return err
+    }
+    return withBot(*configPath, func(b *Bot, _ *discordgo.Session) error {
+        feeds, err := b.selectFeeds(*feedName)
+        if err != nil {
+            return err
+        }
+        states := make(map[string]*FeedState, len(feeds))
+        for _, fw := range feeds {
+            saved, err := fw.loadSaved()
+            if err != nil {
+                return fmt.Errorf("loading state for feed '%s': %w", fw.Name(), err)
+            }
+            if saved != nil {
+                states[fw.Name()] = saved
+            }
+        }
+        enc := json.NewEncoder(os.Stdout)
+        enc.SetIndent("", "  ")
+        return enc.Encode(states)
+    })
+}
+
+// cliStateImport saves every feed in a dump, or a json state file, to the configured store.
+// The bot should be stopped first, it would overwrite the import with its own state.
+func cliStateImport(fs *flag.FlagSet, configPath *string, args []string) error {
+    if err := fs.Parse(args); err != nil {
+        return err
+    }
+    var in io.Reader = os.Stdin
+    if path := fs.Arg(0); path != "" && path != "-" {
+        file, err := os.Open(path)
+        if err != nil {
+            return err
+        }
+        defer file.Close()
+        in = file
+    }
+    states := map[string]*FeedState{}
+    if err := json.NewDecoder(in).Decode(&states); err != nil {
+        return fmt.Errorf("reading state: %w", err)
+    }
+    return withBot(*configPath, func(b *Bot, _ *discordgo.Session) error {
+        names := make([]string, 0, len(states))
+        for name := range states {
+            names = append(names, name)
+        }
+        sort.Strings(names)
+        for _, name := range names {
+            if fw := b.FindFeed(name); fw == nil {
+                fmt.Fprintf(os.Stderr, "No configured feed is named '%s', importing it anyway.\n", name)
+            } else if fw.Config().Url != states[name].Url {
+                fmt.Fprintf(os.Stderr, "Feed '%s' has a different url than its state, it will ignore the import.\n", name)
+            }
+            if err := b.store.SaveFeed(name, states[name]); err != nil {
+                return fmt.Errorf("saving state for '%s': %w", name, err)
+            }
+        }
+        fmt.Printf("Imported state for %d feeds.\n", len(names))
+        return nil
+    })
+}
+
+func cliCommands(fs *flag.FlagSet, configPath *string, args []string) error {
+    if len(args) == 0 {
+        fs.Usage()
+        return errors.New("expected register or unregister")
+    }
+    action := args[0]
+    if action != "register" && action != "unregister" {
+        fs.Usage()
+        return fmt.Errorf("unknown commands command '%s', expected register or unregister", action)
+    }
+    if err := fs.Parse(args[1:]); err != nil {
+        return err
+    }
+    return withBot(*configPath, func(b *Bot, session *discordgo.Session) error {
+        // Without a gateway connection there is no ready event to learn the application id from.
+        user, err := session.User("@me")
+        if err != nil {
+            return fmt.Errorf("getting the bot user: %w", err)
+        }
+        b.appID = user.ID
+        if action == "register" {
+            registered, err := b.UpDiscord()
+            for guildID, cmds := range registered {
+                fmt.Printf("Registered %d commands in %s.\n", len(cmds), scopeName(guildID))
+            }
+            return err
+        }
+        return b.unregisterCommands()
+    })
+}
+
+// unregisterCommands deletes this bot's commands from every scope the config registers them in.
+func (b *Bot) unregisterCommands() error {
+    names := make([]string, 0, len(commands))
+    for _, cmd := range commands {
+        names = append(names, cmd.Name)
+    }
+    for guildID := range commandScopes(b.Config()) {
+        existing, err := b.discord.ApplicationCommands(b.appID, guildID)
+        if err != nil {
+            return fmt.Errorf("listing commands in '%s': %w", guildID, err)
+        }
+        existing = slices.DeleteFunc(existing, func(cmd *discordgo.ApplicationCommand) bool {
+            return !slices.Contains(names, cmd.Name)
+        })
+        if err := b.deleteCommands(guildID, existing); err != nil {
+            return err
+        }
+        fmt.Printf("Unregistered %d commands in %s.\n", len(existing), scopeName(guildID))
+    }
+    return nil
+}
+
+func scopeName(guildID string) string {
+    if guildID == "" {
+        return "every guild (global)"
+    }
+    return "guild " + guildID
+}
@@ -0,0 +1,453 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// maxCommandChoices is the most choices discord takes for one option.
+const maxCommandChoices = 25
+
+var (
+    integerOptionMinValue          = 1.0
+
+    // privateCommands show config and feed details, so they only answer whoever ran them by default.
+    privateCommands = map[string]bool{
+        "checkconfig": true,
+        "checkfeed": true,
+        "preview": true,
+        "status": true,
+    }
+
+    commandHandlers = map[string]func(b *Bot, i *discordgo.InteractionCreate) error {
+        "ping": (*Bot).cmdPingpong,
+        "checkfeed": (*Bot).cmdCheckfeed,
+        "checkconfig": (*Bot).cmdCheckConfig,
+        "postlatest": (*Bot).cmdPostlatest,
+        "postnew": (*Bot).cmdPostNewFeed,
+        "preview": (*Bot).cmdPreview,
+        "status": (*Bot).cmdStatus,
+    }
+    commands = []*discordgo.ApplicationCommand{
+        {
+            Name: "ping",
+            Description: "pong",
+        },
+        {
+            Name: "status",
+            Description: "Check when the bot will start checking for the next episode.",
+            Options: []*discordgo.ApplicationCommandOption{
+                {
+                    Type:        discordgo.ApplicationCommandOptionString,
+                    Name:        "feed",
+                    Description: "Which feed to use, defaults to the first one.",
+                    Required:    false,
+                },
+                {
+                    Type:        discordgo.ApplicationCommandOptionBoolean,
+                    Name:        "public",
+                    Description: "Show the response to everyone in the channel.",
+                    Required:    false,
+                },
+            },
+        },
+        {
+            Name: "checkfeed",
+            Description: "Manually check the feed for a new post.",
+            Options: []*discordgo.ApplicationCommandOption{
+                {
+                    Type:        discordgo.ApplicationCommandOptionInteger,
+                    Name:        "count",
+                    Description: "Number of results to display.",
+                    MinValue:    &integerOptionMinValue,
+                    MaxValue:    15,
+                    Required:    false,
+                },
+                {
+                    Type:        discordgo.ApplicationCommandOptionBoolean,
+                    Name:        "header",
+                    Description: "Display the header?",
+                    Required:    false,
+                },
+                {
+                    Type:        discordgo.ApplicationCommandOptionString,
+                    Name:        "feed",
+                    Description: "Which feed to use, defaults to the first one.",
+                    Required:    false,
+                },
+                {
+                    Type:        discordgo.ApplicationCommandOptionBoolean,
+                    Name:        "public",
+                    Description: "Show the response to everyone in the channel.",
+                    Required:    false,
+                },
+            },
+        },
+        {
+            Name: "checkconfig",
+            Description: "Check channels, feed source and other config settings.",
+            Options: []*discordgo.ApplicationCommandOption{
+                {
+                    Type:        discordgo.ApplicationCommandOptionBoolean,
+                    Name:        "public",
+                    Description: "Show the response to everyone in the channel.",
+                    Required:    false,
+                },
+            },
+        },
+        {
+            Name: "postlatest",
+            Description: "repost the latest item in the feed.",
+            Options: []*discordgo.ApplicationCommandOption{
+                {
+                    Type:        discordgo.ApplicationCommandOptionString,
+                    Name:        "feed",
+                    Description: "Which feed to use, defaults to the first one.",
+                    Required:    false,
+                },
+            },
+        },
+        {
+            Name: "postnew",
+            Description: "Post new items in the feed to every subscribed server.",
+            Options: []*discordgo.ApplicationCommandOption{
+                {
+                    Type:        discordgo.ApplicationCommandOptionString,
+                    Name:        "feed",
+                    Description: "Which feed to use, defaults to the first one.",
+                    Required:    false,
+                },
+            },
+        },
+        {
+            Name: "preview",
+            Description: "Show what the next post would look like here, without posting it.",
+            Options: []*discordgo.ApplicationCommandOption{
+                {
+                    Type:        discordgo.ApplicationCommandOptionString,
+                    Name:        "feed",
+                    Description: "Which feed to use, defaults to the first one.",
+                    Required:    false,
+                },
+                {
+                    Type:        discordgo.ApplicationCommandOptionBoolean,
+                    Name:        "public",
+                    Description: "Show the response to everyone in the channel.",
+                    Required:    false,
+                },
+            },
+        },
+    }
+)
+
+func (b *Bot) cmdPostlatest(i *discordgo.InteractionCreate) error {
+    err := b.deferResponse(i)
+    if err != nil {
+        return err
+    }
+    var content string
+    guild := b.Config().FindGuild(i.GuildID)
+    fw := b.feedFromOptions(i, guild)
+    if guild == nil {
+        content = "This server isn't configured."
+    } else if fw == nil {
+        content = "Unknown feed."
+    } else {
+        target, _ := guild.TargetFor(fw.Config())
+        result, err := fw.PostLatest([]PostTarget{target})
+        if err != nil {
+            content = "Can't query feed '"+redactURL(fw.Config().Url)+"'."
+        } else if result == nil {
+            content = "No new items in feed to post."
+        } else {
+            content = postResultLine(*result)
+        }
+    }
+    return b.editResponse(i, content)
+}
+
+func (b *Bot) cmdCheckConfig(i *discordgo.InteractionCreate) error {
+    guild := b.Config().FindGuild(i.GuildID)
+    if guild == nil {
+        return b.respond(i, "This server isn't configured.")
+    }
+    var content string
+    content += "```\n"
+    for _, fw := range b.Feeds() {
+        target, ok := guild.TargetFor(fw.Config())
+        if !ok {
+            continue
+        }
+        content += fmt.Sprintf("[%s]\n", fw.Name())
+        content += fmt.Sprintf("Post to https://discord.com/channels/%s/%s\n", target.GuildID, target.PostChannelID)
+        content += fmt.Sprintf("Notify to https://discord.com/channels/%s/%s\n", target.GuildID, target.NotifyChannelID)
+        content += fmt.Sprintf("Feed Source `%s`\n", redactURL(fw.Config().Url))
+        content += fmt.Sprintf("Notify Prefix `%s`\n", target.NotifyPrefix)
+        content += fmt.Sprintf("TimeFormat `%s`\n", fw.Config().DiscordMsg.TimeFormat)
+        content += fmt.Sprintf("Post Interval every `%d` hours\n", fw.Config().PostInterval)
+        content += fmt.Sprintf("Cron Job Schedule `%s`\n\n", fw.Config().CronSchedule)
+    }
+    if overrides := b.Config().envOverrides; len(overrides) > 0 {
+        // Only the names, the values are usually secrets.
+        content += fmt.Sprintf("Set from the environment: %s\n\n", strings.Join(overrides, ", "))
+    }
+    content +=
+        "* * * * * *\n"+
+        "| | | | | +----- day of the week (0 - 7) (Sunday is 0 and 7)\n"+
+        "| | | | +------- month (1 - 12)\n"+
+        "| | | +--------- day of the month (1 - 31)\n"+
+        "| | +----------- hour (0 - 23)\n"+
+        "| +------------- minute (0 - 59)\n"+
+        "+--------------- second (0 - 59)\n"+
+        "```\n"
+    return b.respond(i, content)
+}
+
+func (b *Bot) cmdCheckfeed(i *discordgo.InteractionCreate) error {
+    var maxCount = 3
+    var showHeader = false
+    for _, opt := range i.ApplicationCommandData().Options {
+        switch opt.Name {
+            case "count":
+                maxCount = int(opt.IntValue())
+            case "header":
+                showHeader = bool(opt.BoolValue())
+            default:
+        }
+    }
+    err := b.deferResponse(i)
+    if err != nil {
+        return err
+    }
+    var content string
+    fw := b.feedFromOptions(i, b.Config().FindGuild(i.GuildID))
+    if fw == nil {
+        return b.editResponse(i, "Unknown feed.")
+    }
+    feed, header, err := fw.CheckFeed()
+    if err != nil {
+        content = "Can't query feed '"+redactURL(fw.Config().Url)+"'."
+    } else if len(feed.Items) > 0 {
+        if showHeader {
+            content += "```\n"
+            keys := make([]string, 0, len(header))
+            for k := range header {
+                keys = append(keys, k)
+            }
+            slices.Sort(keys)
+            for _, key := range keys {
+                content += fmt.Sprintf("%v: %v\n", key, header[key])
+            }
+            content += "```\n"
+        }
+        for x, item := range feed.Items {
+            if x >= maxCount {
+                break
+            }
+            checkbox := "✅"
+            val, found := fw.state.Visited(item.GUID)
+            if !found {
+                checkbox = "⭕"
+            } else if val == VisitedInit {
+                checkbox = "🔷"
+            } else if val == VisitedSeen {
+                checkbox = "🔴"
+            } else if val == VisitedFiltered {
+                checkbox = "🚫"
+            }
+            published := ""
+            if item.PublishedParsed != nil {
+                published = item.PublishedParsed.Format(fw.Config().DiscordMsg.TimeFormat)
+            }
+            content += fmt.Sprintf(
+                "%d. %s - %s - **%s**. *(%s)*\n",
+                x,
+                checkbox,
+                published,
+                item.Title,
+                item.GUID,
+            )
+        }
+        if len(feed.Items) > maxCount {
+            content += fmt.Sprintf("*%d more...*", len(feed.Items) - maxCount)
+        }
+    } else {
+        content = "No items in feed."
+    }
+    return b.editResponse(i, content)
+}
+
+func (b *Bot) cmdPostNewFeed(i *discordgo.InteractionCreate) error {
+    err := b.deferResponse(i)
+    if err != nil {
+        return err
+    }
+    fw := b.feedFromOptions(i, b.Config().FindGuild(i.GuildID))
+    if fw == nil {
+        return b.editResponse(i, "Unknown feed.")
+    }
+    var content string
+    results, err := fw.PostNew(func(result PostResult) {
+        content += postResultLine(result)
+        err := b.editResponse(i, content + "*Posting...*")
+        if err != nil {
+            logLvlLn(LogDebug, "Error updating postnew progress.", err)
+        }
+    })
+    if err != nil {
+        content = "Can't query feed '"+redactURL(fw.Config().Url)+"'."
+    } else if len(results) == 0 {
+        content = "No new items in feed to post."
+    } else {
+        posted := 0
+        for _, result := range results {
+            if result.Err == nil {
+                posted++
+            }
+        }
+        content += fmt.Sprintf("Posted %d of %d new items.", posted, len(results))
+    }
+    return b.editResponse(i, content)
+}
+
+func (b *Bot) cmdPingpong(i *discordgo.InteractionCreate) error {
+    content := fmt.Sprintf("Pong! `Version %s`", VERSION)
+    return b.respond(i, content)
+}
+
+func (b *Bot) cmdStatus(i *discordgo.InteractionCreate) error {
+    fw := b.feedFromOptions(i, b.Config().FindGuild(i.GuildID))
+    if fw == nil {
+        return b.respond(i, "Unknown feed.")
+    }
+    lastPublished := fw.state.LastPublished()
+    sleepuntil := lastPublished.Add(
+        time.Duration(fw.Config().PostInterval) * time.Hour,
+    )
+    now := b.clock.Now()
+    content := fmt.Sprintf("**%s**\n", fw.Name())
+    if now.After(sleepuntil) {
+        content += fmt.Sprintf(
+            "⏳ Waiting for new posts since `%s`, `%.2f` hours ago.\n", 
+            sleepuntil.Format(time.RFC822Z),
+            now.Sub(sleepuntil).Hours(),
+        )
+    } else {
+        content += fmt.Sprintf(
+            "⏰ Sleeping until `%s` in `%.2f` hours.\n",
+            sleepuntil.Format(time.RFC822Z),
+            sleepuntil.Sub(now).Hours(),
+        )
+    }
+    content += fmt.Sprintf(
+        "🗓️ Last Published on `%s`, `%.2f` hours ago.\n",
+        lastPublished.Format(time.RFC822Z),
+        now.Sub(lastPublished).Hours(),
+    )
+    nextRun, _ := fw.job.NextRun()
+    lastRun, _ := fw.job.LastRun()
+    content += fmt.Sprintf(
+        "⏮️ Previous check ran at `%s`.\n",
+        lastRun.Format(time.RFC822Z),
+    )
+    content += fmt.Sprintf(
+        "⏭️ Next check scheduled for `%s`.\n",
+        nextRun.Format(time.RFC822Z),
+    )
+
+    return b.respond(i, content)
+}
+
+// respond answers the interaction, privately for the commands in privateCommands.
+func (b *Bot) respond(i *discordgo.InteractionCreate, content string) error {
+    return b.respondWithFlags(i, content, responseFlags(i))
+}
+
+func (b *Bot) respondWithFlags(i *discordgo.InteractionCreate, content string, flags discordgo.MessageFlags) error {
+    return b.discord.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+        Type: discordgo.InteractionResponseChannelMessageWithSource,
+        Data: &discordgo.InteractionResponseData{
+            Content: truncateString(content, b.Config().Discord.MaxMessageLength),
+            Flags: flags,
+        },
+    })
+}
+
+// responseFlags makes the diagnostic commands ephemeral unless they were run with public set.
+func responseFlags(i *discordgo.InteractionCreate) discordgo.MessageFlags {
+    if !privateCommands[i.ApplicationCommandData().Name] {
+        return 0
+    }
+    for _, opt := range i.ApplicationCommandData().Options {
+        if opt.Name == "public" && opt.BoolValue() {
+            return 0
+        }
+    }
+    return discordgo.MessageFlagsEphemeral
+}
+
+// deferResponse acknowledges the interaction straight away, so commands that fetch
+// or post can take longer than discord's 3 second limit. Answer with editResponse after.
+func (b *Bot) deferResponse(i *discordgo.InteractionCreate) error {
+    return b.discord.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+        Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+        Data: &discordgo.InteractionResponseData{
+            Flags: responseFlags(i),
+        },
+    })
+}
+
+// editResponse replaces the content of a deferred response.
+func (b *Bot) editResponse(i *discordgo.InteractionCreate, content string) error {
+    content = truncateString(content, b.Config().Discord.MaxMessageLength)
+    _, err := b.discord.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+        Content: &content,
+    })
+    return err
+}
+
+func postResultLine(result PostResult) string {
+    if result.Err != nil {
+        return fmt.Sprintf("❌ Failed '%s': %v\n", result.Item.Title, result.Err)
+    }
+    return fmt.Sprintf("✅ Posted '%s'.\n", result.Item.Title)
+}
+
+// feedFromOptions picks the feed named by the "feed" option, or the guild's first feed.
+// It returns nil when the guild isn't subscribed to the feed.
+func (b *Bot) feedFromOptions(i *discordgo.InteractionCreate, guild *GuildConfig) *FeedWatcher {
+    if guild == nil {
+        return nil
+    }
+    for _, opt := range i.ApplicationCommandData().Options {
+        if opt.Name == "feed" {
+            if !guild.HasFeed(opt.StringValue()) {
+                return nil
+            }
+            return b.FindFeed(opt.StringValue())
+        }
+    }
+    for _, fw := range b.Feeds() {
+        if guild.HasFeed(fw.Name()) {
+            return fw
+        }
+    }
+    return nil
+}
+
+// logCmd is the audit log of who ran or was refused a command.
+func logCmd(cmd string, i *discordgo.InteractionCreate, denied string) {
+    var username, userID string
+    if user := interactionUser(i); user != nil {
+        username, userID = user.Username, user.ID
+    }
+    if denied != "" {
+        logLvlF(LogProd, "%s (%s) was denied ./%s in guild %s: %s", username, userID, cmd, i.GuildID, denied)
+        return
+    }
+    logLvlF(LogProd, "%s (%s) ran ./%s in guild %s", username, userID, cmd, i.GuildID)
+}
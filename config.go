@@ -0,0 +1,400 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+type MsgConfig struct {
+    ArchiveDuration int
+    NotifyPrefix string
+    TimeFormat string
+    // Post the thread as a rich embed instead of the body template.
+    Embed bool
+    // Post descriptions that don't fit in one message as follow up messages in the thread.
+    SplitLongMessages bool
+    // text/template sources, see TemplateData for what they can use.
+    TitleTemplate string
+    BodyTemplate string
+    NotifyTemplate string
+}
+
+// FilterConfig picks which new items of a feed are posted, an item has to pass every rule that is set.
+// Filtered items are remembered as such and never reconsidered, /postlatest and post -guid skip the filter.
+type FilterConfig struct {
+    // Regular expressions, an item has to match one of the Include patterns (if any) and none of the Exclude ones.
+    // Prefix a pattern with (?i) to ignore case.
+    TitleInclude []string
+    TitleExclude []string
+    DescriptionInclude []string
+    DescriptionExclude []string
+    // Categories and authors are matched ignoring case.
+    Categories []string
+    ExcludeCategories []string
+    Authors []string
+    ExcludeAuthors []string
+    // Go durations like "90s" or "1h30m", from itunes:duration or media:content.
+    // Items without a duration always pass, YouTube's feed doesn't have one.
+    MinDuration string
+    MaxDuration string
+    // Skip YouTube Shorts, spotted by their /shorts/ link.
+    ExcludeShorts bool
+}
+
+// ScrapeConfig reads items out of an HTML page for feeds with Type "scrape".
+// Item is a CSS selector for each item on the page, the rest are matched inside it and
+// read the element's text, or an attribute with "selector@attr". "@attr" reads the item element.
+type ScrapeConfig struct {
+    Item string
+    Title string
+    // Defaults to "a@href".
+    Link string
+    // Read as HTML and cleaned up by the feed's Description mode.
+    Description string
+    // Parsed with DateLayout, a Go time layout, or a few common formats without one.
+    Date string
+    DateLayout string
+    // Defaults to "img@src".
+    Image string
+    // Defaults to the link.
+    GUID string
+}
+
+type FeedConfig struct {
+    Name string
+    Url string
+    Type string
+    CronSchedule string
+    PostInterval int
+    NoCache bool
+    // How item descriptions are cleaned up, "markdown" (default), "text" or "raw".
+    Description string
+    // Channels in the [DiscordServer] guild.
+    PostChannelID string
+    NotifyChannelID string
+    DiscordMsg MsgConfig
+    Filter FilterConfig
+    Scrape ScrapeConfig
+}
+
+// GuildFeedConfig subscribes a guild to a feed, channels left blank use the guild defaults.
+type GuildFeedConfig struct {
+    Name string
+    PostChannelID string
+    NotifyChannelID string
+}
+
+type GuildConfig struct {
+    GuildID string
+    PostChannelID string
+    NotifyChannelID string
+    NotifyPrefix string
+    // Feeds left empty subscribes the guild to every feed.
+    Feeds []GuildFeedConfig
+}
+
+// PostTarget is one place a feed item gets posted to.
+type PostTarget struct {
+    GuildID string
+    PostChannelID string
+    NotifyChannelID string
+    NotifyPrefix string
+}
+
+// CommandPermissions limits who can run a slash command.
+// A member needs every bit in DefaultMemberPermissions (administrators always pass),
+// and when Roles or Users are set they also need one of those roles or to be one of those users.
+type CommandPermissions struct {
+    // Discord permission bits, also sent to discord to hide the command from everyone else.
+    // 0 lets anyone run it, leaving it out uses the bot's default for the command.
+    DefaultMemberPermissions *int64
+    Roles []string
+    Users []string
+}
+
+type Config struct {
+    RemoveCommands bool
+    // Register commands once for every guild the bot is in, instead of per configured guild.
+    GlobalCommands bool
+    // Feed is the original single feed setup, it is folded into Feeds when loaded.
+    Feed FeedConfig
+    Feeds []FeedConfig
+    DiscordBot struct {
+        Username string
+        ClientID string
+        ClientSecret string
+        Token string
+        Status string
+        Retries int
+        Logging uint8
+    }
+    DiscordMsg MsgConfig
+    // DiscordServer is the original single guild setup, it is folded into Guilds when loaded.
+    DiscordServer struct {
+        GuildID string
+        PostChannelID string
+        NotifyChannelID string
+    }
+    Guilds []GuildConfig
+    Discord struct {
+        MaxTitleLength int
+        MaxMessageLength int
+    }
+    State struct {
+        Type string
+        Path string
+    }
+    // Fetch configures the HTTP client used to request feeds.
+    Fetch struct {
+        Timeout int // Seconds
+        MaxBodyBytes int64
+        Retries int
+        RetryDelay int // Seconds, doubled each retry
+        UserAgent string
+    }
+    // StatusServer serves /healthz, /readyz and /metrics when Listen is set.
+    StatusServer struct {
+        Listen string
+    }
+    // Permissions keyed by command name.
+    Permissions map[string]CommandPermissions
+    // envOverrides are the settings that came from the environment, for /checkconfig.
+    envOverrides []string
+}
+
+const DefaultCronSchedule = "0 */15 * * * *"
+const DefaultTimeFormat = "06.01.02"
+const DefaultMaxTitleLength = 100
+const DefaultMaxMessageLength = 2000
+// MinMessageLength leaves room for a code block closed and reopened across messages, with text in it.
+const MinMessageLength = 20
+
+// LoadConfig reads the toml config at path, applies the BASEDCAMP_ environment
+// overrides, then normalizes and validates it.
+// Unknown keys are an error, so a typo doesn't silently fall back to a default.
+// They are reported along with every other problem in the file.
+func LoadConfig(path string) (*Config, error) {
+    var config Config
+    var unknownKeys []string
+    env := newEnvOverrides(os.Environ())
+    file, err := os.ReadFile(path)
+    if err == nil {
+        err = toml.NewDecoder(bytes.NewReader(file)).DisallowUnknownFields().Decode(&config)
+        var strictErr *toml.StrictMissingError
+        if errors.As(err, &strictErr) {
+            unknownKeys = unknownKeyProblems(path, strictErr)
+            // Decode again leniently so the rest of the file still gets validated.
+            config = Config{}
+            err = toml.Unmarshal(file, &config)
+        }
+        if err != nil {
+            return nil, decodeError(path, err)
+        }
+    } else if !os.IsNotExist(err) || len(env.env) == 0 {
+        // Without the file everything has to come from the environment.
+        return nil, err
+    }
+    config.envOverrides, err = env.apply(&config)
+    if err != nil {
+        return nil, err
+    }
+
+    config.applyDefaults()
+    config.normalizeFeeds()
+    config.normalizeGuilds()
+    err = config.Validate()
+    if len(unknownKeys) > 0 {
+        problems := unknownKeys
+        var validationErr *ValidationError
+        if errors.As(err, &validationErr) {
+            problems = append(problems, validationErr.Problems...)
+        }
+        return nil, &ValidationError{Problems: problems}
+    }
+    if err != nil {
+        return nil, err
+    }
+    return &config, nil
+}
+
+// unknownKeyProblems points at the line of every unknown key.
+func unknownKeyProblems(path string, strictErr *toml.StrictMissingError) []string {
+    problems := make([]string, 0, len(strictErr.Errors))
+    for _, e := range strictErr.Errors {
+        row, _ := e.Position()
+        problems = append(problems, fmt.Sprintf("%s:%d: unknown key %s", path, row, strings.Join(e.Key(), ".")))
+    }
+    return problems
+}
+
+// decodeError points at the line of a toml syntax error.
+func decodeError(path string, err error) error {
+    var decodeErr *toml.DecodeError
+    if errors.As(err, &decodeErr) {
+        row, col := decodeErr.Position()
+        return fmt.Errorf("%s:%d:%d: %w", path, row, col, err)
+    }
+    return fmt.Errorf("parsing %s: %w", path, err)
+}
+
+// applyDefaults fills in the settings that don't work when left at zero.
+func (c *Config) applyDefaults() {
+    if c.DiscordMsg.TimeFormat == "" {
+        c.DiscordMsg.TimeFormat = DefaultTimeFormat
+    }
+    if c.Discord.MaxTitleLength == 0 {
+        c.Discord.MaxTitleLength = DefaultMaxTitleLength
+    }
+    if c.Discord.MaxMessageLength == 0 {
+        c.Discord.MaxMessageLength = DefaultMaxMessageLength
+    }
+    if c.Fetch.Timeout == 0 {
+        c.Fetch.Timeout = DefaultFetchTimeout
+    }
+    if c.Fetch.MaxBodyBytes == 0 {
+        c.Fetch.MaxBodyBytes = DefaultFetchMaxBodyBytes
+    }
+    if c.Fetch.RetryDelay == 0 {
+        c.Fetch.RetryDelay = DefaultFetchRetryDelay
+    }
+    if c.Fetch.UserAgent == "" {
+        c.Fetch.UserAgent = DefaultUserAgent
+    }
+}
+
+// normalizeFeeds folds the legacy [Feed] table into Feeds and fills in
+// anything a feed leaves blank from the top level tables.
+func (c *Config) normalizeFeeds() {
+    if c.Feed.Url != "" {
+        c.Feeds = append([]FeedConfig{c.Feed}, c.Feeds...)
+    }
+    for x := range c.Feeds {
+        f := &c.Feeds[x]
+        if f.Name == "" {
+            f.Name = fmt.Sprintf("feed%d", x+1)
+        }
+        if f.CronSchedule == "" {
+            f.CronSchedule = DefaultCronSchedule
+        }
+        if f.PostChannelID == "" {
+            f.PostChannelID = c.DiscordServer.PostChannelID
+        }
+        if f.NotifyChannelID == "" {
+            f.NotifyChannelID = c.DiscordServer.NotifyChannelID
+        }
+        if f.DiscordMsg.ArchiveDuration == 0 {
+            f.DiscordMsg.ArchiveDuration = c.DiscordMsg.ArchiveDuration
+        }
+        if f.DiscordMsg.NotifyPrefix == "" {
+            f.DiscordMsg.NotifyPrefix = c.DiscordMsg.NotifyPrefix
+        }
+        if f.DiscordMsg.TimeFormat == "" {
+            f.DiscordMsg.TimeFormat = c.DiscordMsg.TimeFormat
+        }
+        if c.DiscordMsg.Embed {
+            f.DiscordMsg.Embed = true
+        }
+        if c.DiscordMsg.SplitLongMessages {
+            f.DiscordMsg.SplitLongMessages = true
+        }
+        if f.DiscordMsg.TitleTemplate == "" {
+            f.DiscordMsg.TitleTemplate = c.DiscordMsg.TitleTemplate
+        }
+        if f.DiscordMsg.BodyTemplate == "" {
+            f.DiscordMsg.BodyTemplate = c.DiscordMsg.BodyTemplate
+        }
+        if f.DiscordMsg.NotifyTemplate == "" {
+            f.DiscordMsg.NotifyTemplate = c.DiscordMsg.NotifyTemplate
+        }
+        defaultMsgTemplates(&f.DiscordMsg, f.Type)
+    }
+}
+
+// normalizeGuilds folds the legacy [DiscordServer] table into Guilds, subscribing
+// it to every feed with a post channel, and expands each guild's feed list.
+func (c *Config) normalizeGuilds() {
+    if c.DiscordServer.GuildID != "" {
+        home := GuildConfig{GuildID: c.DiscordServer.GuildID}
+        for _, f := range c.Feeds {
+            if f.PostChannelID == "" {
+                continue
+            }
+            home.Feeds = append(home.Feeds, GuildFeedConfig{
+                Name: f.Name,
+                PostChannelID: f.PostChannelID,
+                NotifyChannelID: f.NotifyChannelID,
+            })
+        }
+        c.Guilds = append([]GuildConfig{home}, c.Guilds...)
+    }
+    for x := range c.Guilds {
+        g := &c.Guilds[x]
+        if len(g.Feeds) == 0 {
+            for _, f := range c.Feeds {
+                g.Feeds = append(g.Feeds, GuildFeedConfig{Name: f.Name})
+            }
+        }
+        for y := range g.Feeds {
+            sub := &g.Feeds[y]
+            if sub.PostChannelID == "" {
+                sub.PostChannelID = g.PostChannelID
+            }
+            if sub.NotifyChannelID == "" {
+                sub.NotifyChannelID = g.NotifyChannelID
+            }
+        }
+    }
+}
+
+func (c *Config) FindGuild(guildID string) *GuildConfig {
+    for x := range c.Guilds {
+        if c.Guilds[x].GuildID == guildID {
+            return &c.Guilds[x]
+        }
+    }
+    return nil
+}
+
+// TargetsFor lists every guild channel subscribed to the feed.
+func (c *Config) TargetsFor(feed *FeedConfig) []PostTarget {
+    targets := make([]PostTarget, 0, len(c.Guilds))
+    for _, g := range c.Guilds {
+        if target, ok := g.TargetFor(feed); ok {
+            targets = append(targets, target)
+        }
+    }
+    return targets
+}
+
+func (g *GuildConfig) TargetFor(feed *FeedConfig) (PostTarget, bool) {
+    for _, sub := range g.Feeds {
+        if sub.Name != feed.Name {
+            continue
+        }
+        target := PostTarget{
+            GuildID: g.GuildID,
+            PostChannelID: sub.PostChannelID,
+            NotifyChannelID: sub.NotifyChannelID,
+            NotifyPrefix: g.NotifyPrefix,
+        }
+        if target.NotifyPrefix == "" {
+            target.NotifyPrefix = feed.DiscordMsg.NotifyPrefix
+        }
+        return target, true
+    }
+    return PostTarget{}, false
+}
+
+func (g *GuildConfig) HasFeed(name string) bool {
+    for _, sub := range g.Feeds {
+        if sub.Name == name {
+            return true
+        }
+    }
+    return false
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfigReportsEveryProblem(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "env.toml")
+    config := `
+[DiscordBot]
+Token="test"
+Tokn="typo"
+
+[[Feeds]]
+Name="show"
+Url="https://example.com/feed.xml"
+CronSchedule="every day"
+
+[[Guilds]]
+GuildID="guild"
+PostChannelID="forum"
+`
+    if err := os.WriteFile(path, []byte(config), 0600); err != nil {
+        t.Fatal(err)
+    }
+    _, err := LoadConfig(path)
+    var validationErr *ValidationError
+    if !errors.As(err, &validationErr) {
+        t.Fatalf("expected a ValidationError, got %v", err)
+    }
+    problems := strings.Join(validationErr.Problems, "\n")
+    for _, want := range []string{"unknown key DiscordBot.Tokn", "Feeds[0].CronSchedule"} {
+        if !strings.Contains(problems, want) {
+            t.Errorf("expected a problem about %s, got:\n%s", want, problems)
+        }
+    }
+}
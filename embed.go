@@ -0,0 +1,93 @@
+package main
+
+import (
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/mmcdole/gofeed"
+)
+
+// Embed limits from https://discord.com/developers/docs/resources/message#embed-object-embed-limits
+const EmbedTitleLimit = 256
+const EmbedDescriptionLimit = 4096
+const EmbedAuthorNameLimit = 256
+const EmbedFooterTextLimit = 2048
+const EmbedFieldNameLimit = 256
+const EmbedFieldValueLimit = 1024
+const EmbedFieldsLimit = 25
+const EmbedTotalLimit = 6000
+
+func BuildItemEmbed(feed *gofeed.Feed, item *gofeed.Item, description string) *discordgo.MessageEmbed {
+    embed := &discordgo.MessageEmbed{
+        Type: discordgo.EmbedTypeRich,
+        Title: item.Title,
+        URL: item.Link,
+        Description: description,
+    }
+    if item.PublishedParsed != nil {
+        embed.Timestamp = item.PublishedParsed.Format(time.RFC3339)
+    }
+    if author := itemAuthor(feed, item); author != "" {
+        embed.Author = &discordgo.MessageEmbedAuthor{Name: author}
+    }
+    if thumb := itemThumbnail(item); thumb != "" {
+        embed.Thumbnail = &discordgo.MessageEmbedThumbnail{URL: thumb}
+    }
+    if feed != nil && feed.Title != "" {
+        embed.Footer = &discordgo.MessageEmbedFooter{Text: feed.Title}
+    }
+    enforceEmbedLimits(embed)
+    return embed
+}
+
+func itemAuthor(feed *gofeed.Feed, item *gofeed.Item) string {
+    if item.Author != nil && item.Author.Name != "" {
+        return item.Author.Name
+    }
+    if feed != nil && feed.Author != nil && feed.Author.Name != "" {
+        return feed.Author.Name
+    }
+    return ""
+}
+
+// enforceEmbedLimits truncates each embed field to its own limit,
+// then shortens the description until the whole embed fits in EmbedTotalLimit.
+func enforceEmbedLimits(embed *discordgo.MessageEmbed) {
+    embed.Title = truncateString(embed.Title, EmbedTitleLimit)
+    embed.Description = truncateString(embed.Description, EmbedDescriptionLimit)
+    if embed.Author != nil {
+        embed.Author.Name = truncateString(embed.Author.Name, EmbedAuthorNameLimit)
+    }
+    if embed.Footer != nil {
+        embed.Footer.Text = truncateString(embed.Footer.Text, EmbedFooterTextLimit)
+    }
+    if len(embed.Fields) > EmbedFieldsLimit {
+        embed.Fields = embed.Fields[:EmbedFieldsLimit]
+    }
+    for _, field := range embed.Fields {
+        field.Name = truncateString(field.Name, EmbedFieldNameLimit)
+        field.Value = truncateString(field.Value, EmbedFieldValueLimit)
+    }
+
+    total := embedLength(embed)
+    if total > EmbedTotalLimit {
+        embed.Description = truncateString(
+            embed.Description,
+            max(textLength(embed.Description) - (total - EmbedTotalLimit), 0),
+        )
+    }
+}
+
+func embedLength(embed *discordgo.MessageEmbed) int {
+    total := textLength(embed.Title) + textLength(embed.Description)
+    if embed.Author != nil {
+        total += textLength(embed.Author.Name)
+    }
+    if embed.Footer != nil {
+        total += textLength(embed.Footer.Text)
+    }
+    for _, field := range embed.Fields {
+        total += textLength(field.Name) + textLength(field.Value)
+    }
+    return total
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const EnvPrefix = "BASEDCAMP"
+
+// queryParamSecrets are url query parameters hidden by redactURL.
+var queryParamSecrets = []string{"key", "token", "secret", "password", "auth", "sig", "signature"}
+
+// envOverrides applies BASEDCAMP_<TABLE>_<KEY> variables, and BASEDCAMP_<TABLE>_<KEY>_FILE
+// variables naming a file to read the value from, on top of the decoded config.
+// Array tables are indexed, BASEDCAMP_FEEDS_0_URL, and grow to fit.
+type envOverrides struct {
+    env map[string]string
+    applied []string
+    problems []string
+}
+
+func newEnvOverrides(environ []string) *envOverrides {
+    e := &envOverrides{env: make(map[string]string)}
+    for _, kv := range environ {
+        if key, val, ok := strings.Cut(kv, "="); ok && strings.HasPrefix(key, EnvPrefix+"_") {
+            e.env[key] = val
+        }
+    }
+    return e
+}
+
+// apply sets every field with a matching variable and returns the config paths it set.
+func (e *envOverrides) apply(c *Config) ([]string, error) {
+    e.walk(reflect.ValueOf(c).Elem(), EnvPrefix, "")
+    if len(e.problems) > 0 {
+        return e.applied, &ValidationError{Problems: e.problems}
+    }
+    return e.applied, nil
+}
+
+func (e *envOverrides) walk(v reflect.Value, name string, path string) {
+    switch v.Kind() {
+    case reflect.Struct:
+        t := v.Type()
+        for x := 0; x < t.NumField(); x++ {
+            if !t.Field(x).IsExported() {
+                continue
+            }
+            e.walk(v.Field(x), name+"_"+strings.ToUpper(t.Field(x).Name), joinPath(path, t.Field(x).Name))
+        }
+    case reflect.Slice:
+        if v.Type().Elem().Kind() != reflect.Struct {
+            e.leaf(v, name, path)
+            return
+        }
+        for _, index := range e.subKeys(name) {
+            n, err := strconv.Atoi(index)
+            if err != nil || n < 0 {
+                continue
+            }
+            if n >= v.Len() {
+                v.Set(reflect.AppendSlice(v, reflect.MakeSlice(v.Type(), n+1-v.Len(), n+1-v.Len())))
+            }
+            e.walk(v.Index(n), name+"_"+index, fmt.Sprintf("%s[%d]", path, n))
+        }
+    case reflect.Map:
+        for _, key := range e.subKeys(name) {
+            mapKey := strings.ToLower(key)
+            for _, existing := range v.MapKeys() {
+                if strings.EqualFold(existing.String(), key) {
+                    mapKey = existing.String()
+                }
+            }
+            if v.IsNil() {
+                v.Set(reflect.MakeMap(v.Type()))
+            }
+            elem := reflect.New(v.Type().Elem()).Elem()
+            if current := v.MapIndex(reflect.ValueOf(mapKey)); current.IsValid() {
+                elem.Set(current)
+            }
+            e.walk(elem, name+"_"+key, path+"."+mapKey)
+            v.SetMapIndex(reflect.ValueOf(mapKey), elem)
+        }
+    default:
+        e.leaf(v, name, path)
+    }
+}
+
+// subKeys lists the distinct next name segments of variables under name, like the indexes of an array.
+func (e *envOverrides) subKeys(name string) []string {
+    seen := make(map[string]bool)
+    keys := []string{}
+    for key := range e.env {
+        rest, ok := strings.CutPrefix(key, name+"_")
+        if !ok {
+            continue
+        }
+        sub, _, _ := strings.Cut(rest, "_")
+        if sub != "" && !seen[sub] {
+            seen[sub] = true
+            keys = append(keys, sub)
+        }
+    }
+    sort.Strings(keys)
+    return keys
+}
+
+func (e *envOverrides) leaf(v reflect.Value, name string, path string) {
+    val, ok := e.env[name]
+    if !ok {
+        file, fileOk := e.env[name+"_FILE"]
+        if !fileOk {
+            return
+        }
+        content, err := readSecretFile(file)
+        if err != nil {
+            e.problems = append(e.problems, fmt.Sprintf("%s_FILE: %v", name, err))
+            return
+        }
+        val = content
+    }
+    err := setFromString(v, val)
+    if err != nil {
+        e.problems = append(e.problems, fmt.Sprintf("%s: %v", name, err))
+        return
+    }
+    e.applied = append(e.applied, path)
+}
+
+func setFromString(v reflect.Value, val string) error {
+    if v.Kind() == reflect.Pointer {
+        elem := reflect.New(v.Type().Elem())
+        if err := setFromString(elem.Elem(), val); err != nil {
+            return err
+        }
+        v.Set(elem)
+        return nil
+    }
+    switch v.Kind() {
+    case reflect.String:
+        v.SetString(val)
+    case reflect.Bool:
+        b, err := strconv.ParseBool(val)
+        if err != nil {
+            return fmt.Errorf("'%s' isn't true or false", val)
+        }
+        v.SetBool(b)
+    case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+        n, err := strconv.ParseInt(val, 10, v.Type().Bits())
+        if err != nil {
+            return fmt.Errorf("'%s' isn't a whole number", val)
+        }
+        v.SetInt(n)
+    case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+        n, err := strconv.ParseUint(val, 10, v.Type().Bits())
+        if err != nil {
+            return fmt.Errorf("'%s' isn't a positive whole number", val)
+        }
+        v.SetUint(n)
+    case reflect.Slice:
+        // Lists of strings are comma separated.
+        items := []string{}
+        for _, item := range strings.Split(val, ",") {
+            if item = strings.TrimSpace(item); item != "" {
+                items = append(items, item)
+            }
+        }
+        v.Set(reflect.ValueOf(items))
+    default:
+        return fmt.Errorf("can't be set from the environment")
+    }
+    return nil
+}
+
+// readSecretFile reads a mounted secret, dropping the trailing newline most tools add.
+func readSecretFile(path string) (string, error) {
+    file, err := os.Open(path)
+    if err != nil {
+        return "", err
+    }
+    defer file.Close()
+    content, err := io.ReadAll(io.LimitReader(file, 1<<20))
+    if err != nil {
+        return "", err
+    }
+    return strings.TrimRight(string(content), "\r\n"), nil
+}
+
+func joinPath(path string, name string) string {
+    if path == "" {
+        return name
+    }
+    return path + "." + name
+}
+
+// EnvVarNames lists the variable for every config field, <N> standing in for array indexes.
+func EnvVarNames() []string {
+    names := []string{}
+    var walk func(t reflect.Type, name string)
+    walk = func(t reflect.Type, name string) {
+        switch t.Kind() {
+        case reflect.Struct:
+            for x := 0; x < t.NumField(); x++ {
+                if t.Field(x).IsExported() {
+                    walk(t.Field(x).Type, name+"_"+strings.ToUpper(t.Field(x).Name))
+                }
+            }
+        case reflect.Slice:
+            if t.Elem().Kind() == reflect.Struct {
+                walk(t.Elem(), name+"_<N>")
+            } else {
+                names = append(names, name)
+            }
+        case reflect.Map:
+            walk(t.Elem(), name+"_<COMMAND>")
+        default:
+            names = append(names, name)
+        }
+    }
+    walk(reflect.TypeOf(Config{}), EnvPrefix)
+    return names
+}
+
+// redactURL hides passwords and secret looking query parameters in a feed url.
+func redactURL(raw string) string {
+    u, err := url.Parse(raw)
+    if err != nil {
+        return "(unparsable url)"
+    }
+    if _, ok := u.User.Password(); ok {
+        u.User = url.UserPassword(u.User.Username(), "REDACTED")
+    }
+    query := u.Query()
+    redacted := false
+    for key := range query {
+        for _, secret := range queryParamSecrets {
+            if strings.Contains(strings.ToLower(key), secret) {
+                query.Set(key, "REDACTED")
+                redacted = true
+            }
+        }
+    }
+    if redacted {
+        u.RawQuery = query.Encode()
+    }
+    return u.String()
+}
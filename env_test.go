@@ -0,0 +1,104 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestEnvOverridesGrowArrayTables(t *testing.T) {
+    c := &Config{Feeds: []FeedConfig{{Name: "first", Url: "https://example.com/one.xml"}}}
+    applied, err := newEnvOverrides([]string{
+        "BASEDCAMP_FEEDS_1_URL=https://example.com/two.xml",
+        "BASEDCAMP_FEEDS_1_FILTER_TITLEEXCLUDE=trailer, teaser",
+        "UNRELATED_FEEDS_2_URL=https://example.com/three.xml",
+    }).apply(c)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(c.Feeds) != 2 {
+        t.Fatalf("expected Feeds to grow to 2, got %d", len(c.Feeds))
+    }
+    if c.Feeds[0].Url != "https://example.com/one.xml" || c.Feeds[1].Url != "https://example.com/two.xml" {
+        t.Fatalf("unexpected feed urls %q and %q", c.Feeds[0].Url, c.Feeds[1].Url)
+    }
+    if !slices.Equal(c.Feeds[1].Filter.TitleExclude, []string{"trailer", "teaser"}) {
+        t.Fatalf("expected a comma separated list, got %q", c.Feeds[1].Filter.TitleExclude)
+    }
+    if !slices.Contains(applied, "Feeds[1].Url") {
+        t.Fatalf("expected Feeds[1].Url in the applied settings, got %v", applied)
+    }
+}
+
+func TestEnvOverridesReadSecretFiles(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "token")
+    if err := os.WriteFile(path, []byte("secret token\r\n"), 0600); err != nil {
+        t.Fatal(err)
+    }
+    c := &Config{}
+    c.DiscordBot.Token = "from the file"
+    _, err := newEnvOverrides([]string{"BASEDCAMP_DISCORDBOT_TOKEN_FILE=" + path}).apply(c)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if c.DiscordBot.Token != "secret token" {
+        t.Fatalf("expected the trailing newline to be trimmed, got %q", c.DiscordBot.Token)
+    }
+
+    // The plain variable wins over the file.
+    _, err = newEnvOverrides([]string{
+        "BASEDCAMP_DISCORDBOT_TOKEN=plain",
+        "BASEDCAMP_DISCORDBOT_TOKEN_FILE=" + path,
+    }).apply(c)
+    if err != nil || c.DiscordBot.Token != "plain" {
+        t.Fatalf("expected the plain variable, got %q, %v", c.DiscordBot.Token, err)
+    }
+
+    _, err = newEnvOverrides([]string{"BASEDCAMP_DISCORDBOT_TOKEN_FILE=" + path + ".missing"}).apply(c)
+    if err == nil || !strings.Contains(err.Error(), "BASEDCAMP_DISCORDBOT_TOKEN_FILE") {
+        t.Fatalf("expected an error naming the variable, got %v", err)
+    }
+}
+
+func TestEnvOverridesPermissionKeys(t *testing.T) {
+    c := &Config{Permissions: map[string]CommandPermissions{
+        "postNew": {Users: []string{"123"}},
+    }}
+    _, err := newEnvOverrides([]string{
+        "BASEDCAMP_PERMISSIONS_POSTNEW_ROLES=mods,admins",
+        "BASEDCAMP_PERMISSIONS_CHECKFEED_DEFAULTMEMBERPERMISSIONS=0",
+    }).apply(c)
+    if err != nil {
+        t.Fatal(err)
+    }
+    postNew := c.Permissions["postNew"]
+    if !slices.Equal(postNew.Roles, []string{"mods", "admins"}) || !slices.Equal(postNew.Users, []string{"123"}) {
+        t.Fatalf("expected the existing key to be updated in place, got %+v", c.Permissions)
+    }
+    checkfeed, ok := c.Permissions["checkfeed"]
+    if !ok || checkfeed.DefaultMemberPermissions == nil || *checkfeed.DefaultMemberPermissions != 0 {
+        t.Fatalf("expected a new lowercase checkfeed key with permissions 0, got %+v", c.Permissions)
+    }
+}
+
+func TestEnvOverridesBadValues(t *testing.T) {
+    _, err := newEnvOverrides([]string{
+        "BASEDCAMP_FETCH_TIMEOUT=soon",
+        "BASEDCAMP_REMOVECOMMANDS=maybe",
+        "BASEDCAMP_DISCORDBOT_LOGGING=-1",
+    }).apply(&Config{})
+    if err == nil {
+        t.Fatal("expected an error")
+    }
+    for _, want := range []string{
+        "BASEDCAMP_FETCH_TIMEOUT: 'soon' isn't a whole number",
+        "BASEDCAMP_REMOVECOMMANDS: 'maybe' isn't true or false",
+        "BASEDCAMP_DISCORDBOT_LOGGING: '-1' isn't a positive whole number",
+    } {
+        if !strings.Contains(err.Error(), want) {
+            t.Errorf("expected %q in:\n%v", want, err)
+        }
+    }
+}
@@ -0,0 +1,611 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/go-co-op/gocron/v2"
+	"github.com/mmcdole/gofeed"
+)
+
+// FeedWatcher holds the runtime state of a single configured feed.
+type FeedWatcher struct {
+    bot *Bot
+    setup atomic.Pointer[feedSetup]
+    job gocron.Job
+    state *WatcherState
+    // mu makes fetching, posting and updating the state one pipeline,
+    // so the cron job and commands can't post the same item twice.
+    mu sync.Mutex
+    // Validators and the last feed, used for conditional requests. Guarded by mu.
+    etag string
+    lastModified string
+    cachedBody []byte
+    cachedFeed *gofeed.Feed
+    // unprocessed is set when a parsed feed hasn't been through UpdateVisitedList yet,
+    // so a command fetching the change first doesn't hide it from the cron job.
+    unprocessed bool
+}
+
+// feedSetup is the part of a FeedWatcher that comes from the config,
+// it is replaced as a whole when the config is reloaded.
+type feedSetup struct {
+    cfg *FeedConfig
+    targets []PostTarget
+    tmpl *MsgTemplates
+    filter *ItemFilter
+    source FeedSource
+}
+
+func newFeedSetup(cfg *FeedConfig, targets []PostTarget) (*feedSetup, error) {
+    tmpl, err := ParseMsgTemplates(cfg.DiscordMsg)
+    if err != nil {
+        return nil, err
+    }
+    filter, err := NewItemFilter(cfg.Filter)
+    if err != nil {
+        return nil, err
+    }
+    source, err := newFeedSource(cfg)
+    if err != nil {
+        return nil, fmt.Errorf("Type %s: %w", cfg.Type, err)
+    }
+    return &feedSetup{
+        cfg: cfg,
+        targets: targets,
+        tmpl: tmpl,
+        filter: filter,
+        source: source,
+    }, nil
+}
+
+func NewFeedWatcher(bot *Bot, cfg *FeedConfig, targets []PostTarget) (*FeedWatcher, error) {
+    setup, err := newFeedSetup(cfg, targets)
+    if err != nil {
+        return nil, err
+    }
+    fw := &FeedWatcher{
+        bot: bot,
+        state: NewWatcherState(),
+    }
+    fw.setup.Store(setup)
+    return fw, nil
+}
+
+func (fw *FeedWatcher) Name() string {
+    return fw.Config().Name
+}
+
+func (fw *FeedWatcher) Config() *FeedConfig {
+    return fw.setup.Load().cfg
+}
+
+// Targets are the guild channels subscribed to the feed.
+func (fw *FeedWatcher) Targets() []PostTarget {
+    return fw.setup.Load().targets
+}
+
+func (fw *FeedWatcher) Templates() *MsgTemplates {
+    return fw.setup.Load().tmpl
+}
+
+func (fw *FeedWatcher) Filter() *ItemFilter {
+    return fw.setup.Load().filter
+}
+
+// Source parses the feed as its Type says.
+func (fw *FeedWatcher) Source() FeedSource {
+    return fw.setup.Load().source
+}
+
+// replaceSetup swaps in a reloaded config once nothing is being posted.
+func (fw *FeedWatcher) replaceSetup(setup *feedSetup) {
+    fw.mu.Lock()
+    defer fw.mu.Unlock()
+    // The cached body has to be parsed again by a different source, so fetch it fresh.
+    if setup.cfg.Type != fw.Config().Type || setup.cfg.Scrape != fw.Config().Scrape {
+        fw.etag, fw.lastModified = "", ""
+        fw.cachedBody, fw.cachedFeed = nil, nil
+    }
+    fw.setup.Store(setup)
+}
+
+// PostResult is the outcome of posting one item.
+type PostResult struct {
+    Item *gofeed.Item
+    Err error
+}
+
+func (fw *FeedWatcher) onCronCallback() {
+    logLvlLn(LogDebug, "Cron Callback", fw.Name())
+
+    if fw.inPostInterval() {
+        logLvlLn(LogDebug, "Skipped check outside of post interval", fw.Name())
+        return
+    }
+
+    fw.mu.Lock()
+    defer fw.mu.Unlock()
+    feed, changed, err := fw.FetchFeed()
+    if err != nil {
+        logLvlLn(LogProd, "Error getting feed.", fw.Name(), err)
+        return
+    }
+    // Items still marked seen failed to post or were published while the bot was down,
+    // so they are retried even when the feed hasn't changed.
+    if !changed && !fw.unprocessed && !fw.hasNewItems(feed) {
+        logLvlLn(LogDebug, "Feed not modified", fw.Name())
+        return
+    }
+    fw.postNewItems(feed, nil)
+}
+
+// inPostInterval reports whether PostInterval hours haven't passed since the last post,
+// so the scheduled check is skipped.
+func (fw *FeedWatcher) inPostInterval() bool {
+    return !fw.bot.clock.Now().After(fw.state.LastPublished().Add(
+        time.Duration(fw.Config().PostInterval) * time.Hour,
+    ))
+}
+
+// hasNewItems reports whether any item in the feed still needs posting.
+func (fw *FeedWatcher) hasNewItems(feed *gofeed.Feed) bool {
+    for _, item := range feed.Items {
+        if fw.state.IsNew(item.GUID) {
+            return true
+        }
+    }
+    return false
+}
+
+// PostNew fetches the feed and posts every new item to all subscribed targets.
+// onResult, when set, is called as each item finishes.
+func (fw *FeedWatcher) PostNew(onResult func(PostResult)) ([]PostResult, error) {
+    fw.mu.Lock()
+    defer fw.mu.Unlock()
+    feed, err := fw.GetFeed()
+    if err != nil {
+        logLvlLn(LogProd, "Error getting feed.", fw.Name(), err)
+        return nil, err
+    }
+    return fw.postNewItems(feed, onResult), nil
+}
+
+// PostLatest fetches the feed and posts its newest item to targets, whether or not it was posted before.
+// The result is nil when the feed has no items.
+func (fw *FeedWatcher) PostLatest(targets []PostTarget) (*PostResult, error) {
+    fw.mu.Lock()
+    defer fw.mu.Unlock()
+    feed, err := fw.GetFeed()
+    if err != nil {
+        logLvlLn(LogProd, "Error getting feed.", fw.Name(), err)
+        return nil, err
+    }
+    var result *PostResult
+    if len(feed.Items) > 0 {
+        item := feed.Items[0]
+        result = &PostResult{Item: item, Err: fw.PostFeedItem(feed, item, targets)}
+    }
+    fw.UpdateVisitedList(feed, VisitedSeen)
+    return result, nil
+}
+
+// PostItem posts the item with the given guid to targets, whether or not it was posted before.
+// The result is nil when the feed has no such item.
+func (fw *FeedWatcher) PostItem(guid string, targets []PostTarget) (*PostResult, error) {
+    fw.mu.Lock()
+    defer fw.mu.Unlock()
+    feed, err := fw.GetFeed()
+    if err != nil {
+        logLvlLn(LogProd, "Error getting feed.", fw.Name(), err)
+        return nil, err
+    }
+    var result *PostResult
+    for _, item := range feed.Items {
+        if item.GUID == guid {
+            result = &PostResult{Item: item, Err: fw.PostFeedItem(feed, item, targets)}
+            break
+        }
+    }
+    fw.UpdateVisitedList(feed, VisitedSeen)
+    return result, nil
+}
+
+// CheckFeed fetches and parses the feed, also returning the response header.
+func (fw *FeedWatcher) CheckFeed() (*gofeed.Feed, http.Header, error) {
+    fw.mu.Lock()
+    defer fw.mu.Unlock()
+    body, header, _, err := fw.RequestFeed()
+    if err != nil {
+        return nil, header, err
+    }
+    feed, err := fw.ParseFeed(body)
+    return feed, header, err
+}
+
+// newItems splits the feed's items that haven't been posted yet into
+// the ones to post and the ones the filter rules out.
+func (fw *FeedWatcher) newItems(feed *gofeed.Feed) (items []*gofeed.Item, filtered []*gofeed.Item) {
+    for _, item := range feed.Items {
+        if !fw.state.IsNew(item.GUID) {
+            continue
+        }
+        if fw.Filter().Check(feed, item) != "" {
+            filtered = append(filtered, item)
+        } else {
+            items = append(items, item)
+        }
+    }
+    return items, filtered
+}
+
+// postNewItems posts the items that aren't posted yet, the caller holds mu.
+func (fw *FeedWatcher) postNewItems(feed *gofeed.Feed, onResult func(PostResult)) []PostResult {
+    results := []PostResult{}
+    items, filtered := fw.newItems(feed)
+    for _, item := range filtered {
+        logLvlF(LogDebug, "Filtered out '%s' (%s) from %s, %s.", item.Title, item.GUID, fw.Name(), fw.Filter().Check(feed, item))
+        fw.state.MarkFiltered(item.GUID)
+    }
+    for _, item := range items {
+        result := PostResult{Item: item, Err: fw.PostFeedItem(feed, item, fw.Targets())}
+        results = append(results, result)
+        if onResult != nil {
+            onResult(result)
+        }
+    }
+    fw.UpdateVisitedList(feed, VisitedSeen)
+    return results
+}
+
+func (fw *FeedWatcher) UpdateVisitedList(feed *gofeed.Feed, visitType uint8) {
+    guids := make([]string, 0, len(feed.Items))
+    for _, item := range feed.Items {
+        guids = append(guids, item.GUID)
+    }
+    fw.state.Update(guids, visitType)
+    fw.unprocessed = false
+    fw.SaveState()
+}
+
+// PostFeedItem posts the item to every target, it is marked posted once any target has a thread.
+func (fw *FeedWatcher) PostFeedItem(feed *gofeed.Feed, item *gofeed.Item, targets []PostTarget) error {
+    logLvlLn(LogDebug, "Posting.", fw.Name(), item.GUID, item.Title)
+    if len(targets) == 0 {
+        return fmt.Errorf("no guild is subscribed to feed '%s'", fw.Name())
+    }
+    var errs []error
+    for _, target := range targets {
+        err := fw.postToTarget(feed, item, target)
+        if err != nil {
+            errs = append(errs, err)
+        }
+    }
+    if len(errs) == 0 {
+        logLvlLn(LogProd, "Posted new episode.", fw.Name())
+    }
+    return errors.Join(errs...)
+}
+
+// PostPreview is everything posting an item to one target sends, rendered but not sent.
+type PostPreview struct {
+    Target PostTarget
+    Title string
+    // Body is the thread's first message, unless Embed is set.
+    Body string
+    Embed *discordgo.MessageEmbed
+    Followups []string
+    // Notify is empty when the target has no notify channel.
+    Notify string
+    data *TemplateData
+}
+
+// renderPost runs the templates for an item the same way for posting and previews.
+// The notify message is left to renderNotify, it links to the thread.
+func (fw *FeedWatcher) renderPost(feed *gofeed.Feed, item *gofeed.Item, target PostTarget) (*PostPreview, error) {
+    msg := fw.Config().DiscordMsg
+    data := &TemplateData{
+        Feed: feed,
+        Item: item,
+        Description: SanitizeDescription(item.Description, fw.Config().Description),
+        FeedName: fw.Name(),
+        TimeFormat: msg.TimeFormat,
+        NotifyPrefix: target.NotifyPrefix,
+        GuildID: target.GuildID,
+    }
+    fw.Source().Extend(data)
+    post := &PostPreview{Target: target, data: data}
+
+    // Whatever doesn't fit in the first message is kept for follow ups when splitting.
+    if msg.Embed && msg.SplitLongMessages {
+        parts := SplitMessage(data.Description, EmbedDescriptionLimit)
+        if len(parts) > 1 {
+            data.Description = parts[0]
+            post.Followups = SplitMessage(strings.Join(parts[1:], "\n\n"), fw.bot.Config().Discord.MaxMessageLength)
+        }
+    }
+
+    body, err := RenderTemplate(fw.Templates().Body, data)
+    if err != nil {
+        return nil, err
+    }
+    if !msg.Embed && msg.SplitLongMessages {
+        parts := SplitMessage(body, fw.bot.Config().Discord.MaxMessageLength)
+        if len(parts) > 0 {
+            body, post.Followups = parts[0], parts[1:]
+        }
+    }
+    if msg.Embed {
+        post.Embed = BuildItemEmbed(feed, item, data.Description)
+        if data.Podcast != nil {
+            addPodcastEmbedFields(post.Embed, data.Podcast)
+        }
+    } else {
+        post.Body = truncateString(body, fw.bot.Config().Discord.MaxMessageLength)
+    }
+
+    title, err := RenderTemplate(fw.Templates().Title, data)
+    if err != nil {
+        return nil, err
+    }
+    post.Title = truncateString(title, fw.bot.Config().Discord.MaxTitleLength)
+    return post, nil
+}
+
+// renderNotify renders the notify message pointing at link, or "" without a notify channel.
+func (fw *FeedWatcher) renderNotify(post *PostPreview, link string) (string, error) {
+    if post.Target.NotifyChannelID == "" {
+        return "", nil
+    }
+    post.data.Link = link
+    body, err := RenderTemplate(fw.Templates().Notify, post.data)
+    if err != nil {
+        return "", err
+    }
+    return truncateString(body, fw.bot.Config().Discord.MaxMessageLength), nil
+}
+
+func (fw *FeedWatcher) postToTarget(feed *gofeed.Feed, item *gofeed.Item, target PostTarget) error {
+    msg := fw.Config().DiscordMsg
+    post, err := fw.renderPost(feed, item, target)
+    if err != nil {
+        logLvlLn(LogProd, "Error rendering post.", fw.Name(), err)
+        return err
+    }
+    title := post.Title
+
+    var postMsg *discordgo.Channel
+    if msg.Embed {
+        postMsg, err = fw.bot.discord.ForumThreadStartComplex(
+            target.PostChannelID,
+            &discordgo.ThreadStart{
+                Name: title,
+                AutoArchiveDuration: msg.ArchiveDuration,
+            },
+            &discordgo.MessageSend{
+                Embeds: []*discordgo.MessageEmbed{post.Embed},
+            },
+        )
+    } else {
+        postMsg, err = fw.bot.discord.ForumThreadStart(target.PostChannelID,title,msg.ArchiveDuration,post.Body)
+    }
+    if err != nil {
+        logLvlLn(LogProd, "Error making ForumThread post.", target.GuildID, err, title)
+        return err
+    }
+    logLvlF(LogDebug, "Created ForumThread post. '%s' [%s] (%s)", title, postMsg.ID, item.GUID)
+    metricPostsCreated.Inc(fw.Name(), target.GuildID)
+
+    record := PostRecord{
+        GuildID: target.GuildID,
+        ThreadID: postMsg.ID,
+        ParentID: postMsg.ParentID,
+        PostedAt: fw.bot.clock.Now(),
+    }
+    var published time.Time
+    if item.PublishedParsed != nil {
+        published = *item.PublishedParsed
+    }
+    fw.state.MarkPosted(item.GUID, published, record)
+    fw.SaveState()
+
+    // The forum thread's id doubles as its channel id.
+    for _, followup := range post.Followups {
+        followupMsg, err := fw.bot.discord.ChannelMessageSend(postMsg.ID, followup)
+        if err != nil {
+            logLvlLn(LogProd, "Error sending follow up message.", target.GuildID, err)
+            break
+        }
+        record.FollowupIDs = append(record.FollowupIDs, followupMsg.ID)
+    }
+    if len(record.FollowupIDs) > 0 {
+        logLvlLn(LogDebug, "Sent follow up messages.", len(record.FollowupIDs))
+        fw.state.UpdatePost(item.GUID, record)
+        fw.SaveState()
+    }
+
+    if target.NotifyChannelID == "" {
+        return nil
+    }
+    body, err := fw.renderNotify(post, "https://discord.com/channels/"+target.GuildID+"/"+postMsg.ParentID+"/"+postMsg.ID)
+    if err != nil {
+        logLvlLn(LogProd, "Error rendering notify message.", fw.Name(), err)
+        return err
+    }
+
+    notifyMsg, err := fw.bot.discord.ChannelMessageSend(target.NotifyChannelID, body)
+
+    if err != nil {
+        metricNotifyFailures.Inc(fw.Name(), target.GuildID)
+        logLvlLn(LogProd, "Error sending discord notify message.", target.GuildID, err, body)
+        return err
+    }
+    record.NotifyChannelID = notifyMsg.ChannelID
+    record.NotifyMessageID = notifyMsg.ID
+    fw.state.UpdatePost(item.GUID, record)
+    fw.SaveState()
+    logLvlLn(LogDebug, "Created notification message", notifyMsg.ID, body)
+    return nil
+}
+
+func (fw *FeedWatcher) Init() error {
+    fw.mu.Lock()
+    defer fw.mu.Unlock()
+    saved, err := fw.loadSaved()
+    if err != nil {
+        return fmt.Errorf("loading state for feed '%s': %w", fw.Name(), err)
+    }
+    feed, err := fw.GetFeed()
+    if err != nil {
+        return fmt.Errorf("getting feed '%s': %w", fw.Name(), err)
+    }
+
+    // Without saved state everything currently in the feed is treated as old news.
+    // With saved state anything we haven't seen was published while we were down.
+    visitType := VisitedInit
+    if saved != nil {
+        visitType = VisitedSeen
+        fw.state.Load(saved)
+        logLvlLn(LogDebug, "Loaded saved feed state.", fw.Name(), len(saved.Visited))
+    } else {
+        var lastPublished time.Time
+        for _, item := range feed.Items {
+            if item.PublishedParsed != nil && item.PublishedParsed.After(lastPublished) {
+                lastPublished = *item.PublishedParsed
+            }
+        }
+        fw.state.Load(&FeedState{LastPublished: lastPublished})
+    }
+    fw.UpdateVisitedList(feed, visitType)
+    logLvlLn(LogDebug, "Added visitedList.", fw.Name(), fw.state.Snapshot().Visited)
+    return nil
+}
+
+// loadState restores the saved state without fetching anything, for one-shot runs.
+// It reports false when nothing was saved for the feed yet.
+func (fw *FeedWatcher) loadState() (bool, error) {
+    saved, err := fw.loadSaved()
+    if err != nil {
+        return false, fmt.Errorf("loading state for feed '%s': %w", fw.Name(), err)
+    }
+    if saved == nil {
+        return false, nil
+    }
+    fw.state.Load(saved)
+    return true, nil
+}
+
+// loadSaved reads the feed's state from the store, saved under its name.
+// Feeds can share a url with different filters or guilds, so the url can't be the key.
+// State saved for another url is ignored, the feed starts over as a new one.
+func (fw *FeedWatcher) loadSaved() (*FeedState, error) {
+    saved, err := fw.bot.store.LoadFeed(fw.Name())
+    if err != nil || saved == nil {
+        return saved, err
+    }
+    if saved.Url != fw.Config().Url {
+        logLvlF(LogProd, "Ignoring the saved state of feed '%s', it was saved for another url.", fw.Name())
+        return nil, nil
+    }
+    return saved, nil
+}
+
+func (fw *FeedWatcher) SaveState() {
+    snap := fw.state.Snapshot()
+    snap.Url = fw.Config().Url
+    err := fw.bot.store.SaveFeed(fw.Name(), snap)
+    if err != nil {
+        logLvlLn(LogProd, "Error saving feed state.", fw.Name(), err)
+    }
+}
+
+func (fw *FeedWatcher) GetFeed() (feed *gofeed.Feed, err error) {
+    feed, _, err = fw.FetchFeed()
+    return feed, err
+}
+
+// FetchFeed is GetFeed that also reports whether the feed changed since the last request.
+// An unchanged feed isn't parsed again, the last parsed feed is returned instead.
+func (fw *FeedWatcher) FetchFeed() (feed *gofeed.Feed, changed bool, err error) {
+    body, _, changed, err := fw.RequestFeed()
+    if err != nil {
+        return feed, changed, err
+    }
+    if !changed && fw.cachedFeed != nil {
+        return fw.cachedFeed, false, nil
+    }
+    feed, err = fw.ParseFeed(body)
+    return feed, true, err
+}
+
+func (fw *FeedWatcher) ParseFeed(body []byte) (*gofeed.Feed, error) {
+    feed, err := fw.Source().Parse(body)
+    if err != nil {
+        metricParseFailures.Inc(fw.Name())
+        return feed, err
+    }
+    fillPublished(feed, fw.bot.clock.Now())
+    fw.cachedFeed = feed
+    fw.unprocessed = true
+    return feed, err
+}
+
+// RequestFeed makes a conditional request for the feed.
+// On a 304 Not Modified the last body is returned and changed is false.
+func (fw *FeedWatcher) RequestFeed() (body []byte, header http.Header, changed bool, err error) {
+    defer func() {
+        if err != nil {
+            metricFeedFetches.Inc(fw.Name(), "error")
+        } else {
+            metricFeedFetches.Inc(fw.Name(), "ok")
+            metricLastFetch.Set(float64(fw.bot.clock.Now().Unix()), fw.Name())
+        }
+    }()
+    req, err := http.NewRequest("GET", fw.Config().Url, nil)
+    if err != nil {
+        return body, header, false, err
+    }
+    if fw.Config().NoCache {
+        req.Header.Set("Pragma", "no-cache")
+        req.Header.Set("Cache-Control", "no-cache")
+    }
+    if fw.cachedBody != nil {
+        if fw.etag != "" {
+            req.Header.Set("If-None-Match", fw.etag)
+        }
+        if fw.lastModified != "" {
+            req.Header.Set("If-Modified-Since", fw.lastModified)
+        }
+    }
+    resp, err := fw.bot.fetcher.Do(req)
+    if err != nil {
+        return body, header, false, err
+    }
+    defer resp.Body.Close()
+
+    header = resp.Header
+    if resp.StatusCode == http.StatusNotModified && fw.cachedBody != nil {
+        return fw.cachedBody, header, false, nil
+    }
+
+    body, err = fw.bot.fetcher.ReadBody(resp)
+    if err != nil {
+        return body, header, false, err
+    }
+    fw.etag = header.Get("ETag")
+    fw.lastModified = header.Get("Last-Modified")
+    fw.cachedBody = body
+    return body, header, true, nil
+}
+
+func ParseFeed(body string) (feed *gofeed.Feed, err error) {
+    fp := gofeed.NewParser()
+    feed, err = fp.ParseString(body)
+    return feed, err
+}
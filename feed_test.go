@@ -0,0 +1,453 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+type fakeClock struct {
+    now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+    return c.now
+}
+
+// fakeDiscord records the threads it is asked to start, and fails every call while down is set.
+type fakeDiscord struct {
+    mu sync.Mutex
+    down bool
+    threads []string
+    messages []string
+}
+
+var errDiscordDown = errors.New("discord is down")
+
+func (d *fakeDiscord) setDown(down bool) {
+    d.mu.Lock()
+    defer d.mu.Unlock()
+    d.down = down
+}
+
+func (d *fakeDiscord) Threads() []string {
+    d.mu.Lock()
+    defer d.mu.Unlock()
+    return append([]string(nil), d.threads...)
+}
+
+func (d *fakeDiscord) startThread(channelID string, name string) (*discordgo.Channel, error) {
+    d.mu.Lock()
+    defer d.mu.Unlock()
+    if d.down {
+        return nil, errDiscordDown
+    }
+    d.threads = append(d.threads, name)
+    return &discordgo.Channel{ID: fmt.Sprintf("thread%d", len(d.threads)), ParentID: channelID}, nil
+}
+
+func (d *fakeDiscord) ForumThreadStart(channelID, name string, archiveDuration int, content string, options ...discordgo.RequestOption) (*discordgo.Channel, error) {
+    return d.startThread(channelID, name)
+}
+
+func (d *fakeDiscord) ForumThreadStartComplex(channelID string, threadData *discordgo.ThreadStart, messageData *discordgo.MessageSend, options ...discordgo.RequestOption) (*discordgo.Channel, error) {
+    return d.startThread(channelID, threadData.Name)
+}
+
+func (d *fakeDiscord) ChannelMessageSend(channelID string, content string, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+    d.mu.Lock()
+    defer d.mu.Unlock()
+    if d.down {
+        return nil, errDiscordDown
+    }
+    d.messages = append(d.messages, content)
+    return &discordgo.Message{ID: fmt.Sprintf("message%d", len(d.messages)), ChannelID: channelID}, nil
+}
+
+func (d *fakeDiscord) InteractionRespond(interaction *discordgo.Interaction, resp *discordgo.InteractionResponse, options ...discordgo.RequestOption) error {
+    return nil
+}
+
+func (d *fakeDiscord) InteractionResponseEdit(interaction *discordgo.Interaction, newresp *discordgo.WebhookEdit, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+    return &discordgo.Message{}, nil
+}
+
+func (d *fakeDiscord) FollowupMessageCreate(interaction *discordgo.Interaction, wait bool, data *discordgo.WebhookParams, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+    return &discordgo.Message{}, nil
+}
+
+func (d *fakeDiscord) ApplicationCommandCreate(appID string, guildID string, cmd *discordgo.ApplicationCommand, options ...discordgo.RequestOption) (*discordgo.ApplicationCommand, error) {
+    return cmd, nil
+}
+
+func (d *fakeDiscord) ApplicationCommandDelete(appID, guildID, cmdID string, options ...discordgo.RequestOption) error {
+    return nil
+}
+
+func (d *fakeDiscord) ApplicationCommands(appID, guildID string, options ...discordgo.RequestOption) ([]*discordgo.ApplicationCommand, error) {
+    return nil, nil
+}
+
+// fakeFetcher sends requests with a plain client and counts them.
+type fakeFetcher struct {
+    requests int
+}
+
+func (f *fakeFetcher) Do(req *http.Request) (*http.Response, error) {
+    f.requests++
+    return http.DefaultClient.Do(req)
+}
+
+func (f *fakeFetcher) ReadBody(resp *http.Response) ([]byte, error) {
+    return io.ReadAll(resp.Body)
+}
+
+// feedServer serves a feed with an ETag and answers 304 while it hasn't changed.
+type feedServer struct {
+    *httptest.Server
+    mu sync.Mutex
+    body string
+    version int
+    notModified int
+}
+
+func newFeedServer(t *testing.T, body string) *feedServer {
+    s := &feedServer{body: body}
+    s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        s.mu.Lock()
+        defer s.mu.Unlock()
+        etag := fmt.Sprintf(`"v%d"`, s.version)
+        if r.Header.Get("If-None-Match") == etag {
+            s.notModified++
+            w.WriteHeader(http.StatusNotModified)
+            return
+        }
+        w.Header().Set("ETag", etag)
+        io.WriteString(w, s.body)
+    }))
+    t.Cleanup(s.Close)
+    return s
+}
+
+func (s *feedServer) setBody(body string) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.body = body
+    s.version++
+}
+
+type testItem struct {
+    guid string
+    title string
+    published string
+}
+
+func rssFeed(items ...testItem) string {
+    var sb strings.Builder
+    sb.WriteString(`<?xml version="1.0"?><rss version="2.0"><channel><title>Show</title><link>https://example.com</link>`)
+    for _, item := range items {
+        fmt.Fprintf(&sb, `<item><guid>%s</guid><title>%s</title><link>https://example.com/%s</link><pubDate>%s</pubDate></item>`,
+            item.guid, item.title, item.guid, item.published)
+    }
+    sb.WriteString(`</channel></rss>`)
+    return sb.String()
+}
+
+var (
+    jan1 = testItem{"ep1", "Episode 1", "Mon, 01 Jan 2024 10:00:00 +0000"}
+    jan2 = testItem{"ep2", "Episode 2", "Tue, 02 Jan 2024 10:00:00 +0000"}
+    jan3 = testItem{"ep3", "Episode 3", "Wed, 03 Jan 2024 10:00:00 +0000"}
+)
+
+// testBot is a bot wired to fakes, posting every feed to one forum channel.
+type testBot struct {
+    *Bot
+    discord *fakeDiscord
+    fetcher *fakeFetcher
+    clock *fakeClock
+}
+
+// newTestBot loads feeds, the [[Feeds]] tables of a config, with the state saved at statePath.
+func newTestBot(t *testing.T, statePath string, feeds string) *testBot {
+    t.Helper()
+    configPath := filepath.Join(t.TempDir(), "env.toml")
+    config := fmt.Sprintf(`
+[DiscordBot]
+Token="test"
+Logging=0
+
+[[Guilds]]
+GuildID="guild"
+PostChannelID="forum"
+
+[State]
+Path=%q
+%s`, statePath, feeds)
+    if err := os.WriteFile(configPath, []byte(config), 0600); err != nil {
+        t.Fatal(err)
+    }
+    cfg, err := LoadConfig(configPath)
+    if err != nil {
+        t.Fatal(err)
+    }
+    logLevel = cfg.DiscordBot.Logging
+    store, err := NewJSONStateStore(statePath)
+    if err != nil {
+        t.Fatal(err)
+    }
+    tb := &testBot{
+        discord: &fakeDiscord{},
+        fetcher: &fakeFetcher{},
+        clock: &fakeClock{now: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+    }
+    tb.Bot, err = NewBot(cfg, tb.discord, tb.fetcher, tb.clock, store)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return tb
+}
+
+func feedTable(name string, url string) string {
+    return fmt.Sprintf("\n[[Feeds]]\nName=%q\nUrl=%q\n", name, url)
+}
+
+func (tb *testBot) feed(t *testing.T, name string) *FeedWatcher {
+    t.Helper()
+    fw := tb.FindFeed(name)
+    if fw == nil {
+        t.Fatalf("no feed named '%s'", name)
+    }
+    if err := fw.Init(); err != nil {
+        t.Fatal(err)
+    }
+    return fw
+}
+
+func TestCronRetriesFailedPostsWhileNotModified(t *testing.T) {
+    server := newFeedServer(t, rssFeed(jan1))
+    tb := newTestBot(t, filepath.Join(t.TempDir(), "state.json"), feedTable("show", server.URL))
+    fw := tb.feed(t, "show")
+
+    server.setBody(rssFeed(jan2, jan1))
+    tb.discord.setDown(true)
+    fw.onCronCallback()
+    if threads := tb.discord.Threads(); len(threads) != 0 {
+        t.Fatalf("posted %v while discord was down", threads)
+    }
+
+    tb.discord.setDown(false)
+    fw.onCronCallback()
+    if server.notModified == 0 {
+        t.Fatal("expected the retry to get a 304")
+    }
+    if threads := tb.discord.Threads(); len(threads) != 1 || !strings.Contains(threads[0], "Episode 2") {
+        t.Fatalf("expected Episode 2 to be posted once discord recovered, got %v", threads)
+    }
+    if val, _ := fw.state.Visited(jan2.guid); val != VisitedPosted {
+        t.Fatalf("expected %s to be marked posted, got %d", jan2.guid, val)
+    }
+}
+
+func TestCronPostsItemsPublishedWhileDown(t *testing.T) {
+    statePath := filepath.Join(t.TempDir(), "state.json")
+    server := newFeedServer(t, rssFeed(jan1))
+    first := newTestBot(t, statePath, feedTable("show", server.URL))
+    first.feed(t, "show")
+    first.store.Close()
+
+    server.setBody(rssFeed(jan2, jan1))
+    restarted := newTestBot(t, statePath, feedTable("show", server.URL))
+    fw := restarted.feed(t, "show")
+    fw.onCronCallback()
+    if threads := restarted.discord.Threads(); len(threads) != 1 || !strings.Contains(threads[0], "Episode 2") {
+        t.Fatalf("expected the episode published while down to be posted, got %v", threads)
+    }
+    fw.onCronCallback()
+    if threads := restarted.discord.Threads(); len(threads) != 1 {
+        t.Fatalf("expected no reposts, got %v", threads)
+    }
+}
+
+func TestLastPublishedOnlyMovesForward(t *testing.T) {
+    server := newFeedServer(t, rssFeed(jan1))
+    tb := newTestBot(t, filepath.Join(t.TempDir(), "state.json"), feedTable("show", server.URL))
+    fw := tb.feed(t, "show")
+
+    server.setBody(rssFeed(jan3, jan2, jan1))
+    fw.onCronCallback()
+    if threads := tb.discord.Threads(); len(threads) != 2 {
+        t.Fatalf("expected two posts, got %v", threads)
+    }
+    want := time.Date(2024, 1, 3, 10, 0, 0, 0, time.UTC)
+    if got := fw.state.LastPublished(); !got.Equal(want) {
+        t.Fatalf("expected last published %v, got %v", want, got)
+    }
+
+    if _, err := fw.PostItem(jan1.guid, fw.Targets()); err != nil {
+        t.Fatal(err)
+    }
+    if got := fw.state.LastPublished(); !got.Equal(want) {
+        t.Fatalf("reposting an old item moved last published to %v", got)
+    }
+}
+
+func TestUndatedItemsAreDated(t *testing.T) {
+    server := newFeedServer(t, `{"version": "https://jsonfeed.org/version/1.1", "title": "Show",
+        "items": [{"id": "ep1", "title": "Episode 1", "url": "https://example.com/ep1"}]}`)
+    tb := newTestBot(t, filepath.Join(t.TempDir(), "state.json"), feedTable("show", server.URL)+`Type="json"`+"\n")
+    fw := tb.feed(t, "show")
+
+    server.setBody(`{"version": "https://jsonfeed.org/version/1.1", "title": "Show", "items": [
+        {"id": "ep2", "title": "Episode 2", "url": "https://example.com/ep2", "date_modified": "2024-01-02T10:00:00Z"},
+        {"id": "ep3", "title": "Episode 3", "url": "https://example.com/ep3"},
+        {"id": "ep1", "title": "Episode 1", "url": "https://example.com/ep1"}]}`)
+    results, err := fw.PostNew(nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(results) != 2 {
+        t.Fatalf("expected two posts, got %d", len(results))
+    }
+    for _, result := range results {
+        if result.Err != nil {
+            t.Fatal(result.Err)
+        }
+    }
+    if published := results[0].Item.PublishedParsed; published == nil || published.Day() != 2 {
+        t.Fatalf("expected the updated date to stand in for the published date, got %v", published)
+    }
+    if published := results[1].Item.PublishedParsed; published == nil || !published.Equal(tb.clock.now) {
+        t.Fatalf("expected an undated item to be dated now, got %v", published)
+    }
+}
+
+func TestFeedsSharingUrlKeepTheirOwnState(t *testing.T) {
+    statePath := filepath.Join(t.TempDir(), "state.json")
+    server := newFeedServer(t, rssFeed(jan1))
+    feeds := feedTable("all", server.URL) + feedTable("filtered", server.URL) + "[Feeds.Filter]\nTitleExclude=[\"Episode 2\"]\n"
+    tb := newTestBot(t, statePath, feeds)
+    all := tb.feed(t, "all")
+    filtered := tb.feed(t, "filtered")
+
+    server.setBody(rssFeed(jan2, jan1))
+    all.onCronCallback()
+    filtered.onCronCallback()
+    tb.store.Close()
+
+    restarted := newTestBot(t, statePath, feeds)
+    for name, want := range map[string]uint8{"all": VisitedPosted, "filtered": VisitedFiltered} {
+        fw := restarted.feed(t, name)
+        if val, _ := fw.state.Visited(jan2.guid); val != want {
+            t.Fatalf("feed '%s' saved %s as %d, expected %d", name, jan2.guid, val, want)
+        }
+    }
+    if threads := tb.discord.Threads(); len(threads) != 1 {
+        t.Fatalf("expected one post, got %v", threads)
+    }
+}
+
+func TestRegisterCommandsInEachGuild(t *testing.T) {
+    server := newFeedServer(t, rssFeed(jan1))
+    tb := newTestBot(t, filepath.Join(t.TempDir(), "state.json"), feedTable("show", server.URL))
+    registered, err := tb.UpDiscord()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if cmds := registered["guild"]; len(cmds) != len(commands) {
+        t.Fatalf("expected %d commands in the guild, got %d", len(commands), len(cmds))
+    }
+    if err := tb.DownDiscord(registered); err != nil {
+        t.Fatal(err)
+    }
+}
+
+func TestChangedUrlStartsOver(t *testing.T) {
+    statePath := filepath.Join(t.TempDir(), "state.json")
+    old := newFeedServer(t, rssFeed(jan1))
+    first := newTestBot(t, statePath, feedTable("show", old.URL))
+    first.feed(t, "show")
+    first.store.Close()
+
+    moved := newFeedServer(t, rssFeed(jan3, jan2, jan1))
+    restarted := newTestBot(t, statePath, feedTable("show", moved.URL))
+    fw := restarted.feed(t, "show")
+    fw.onCronCallback()
+    if threads := restarted.discord.Threads(); len(threads) != 0 {
+        t.Fatalf("expected a feed with a new url to treat its items as old news, posted %v", threads)
+    }
+    if val, _ := fw.state.Visited(jan3.guid); val != VisitedInit {
+        t.Fatalf("expected %s to be marked skipped, got %d", jan3.guid, val)
+    }
+}
+
+func TestCliPostNew(t *testing.T) {
+    statePath := filepath.Join(t.TempDir(), "state.json")
+    server := newFeedServer(t, rssFeed(jan1))
+    first := newTestBot(t, statePath, feedTable("show", server.URL))
+    if err := cliPostNew(first.FindFeed("show")); err != nil {
+        t.Fatal(err)
+    }
+    if threads := first.discord.Threads(); len(threads) != 0 {
+        t.Fatalf("expected the first run to post nothing, got %v", threads)
+    }
+    first.store.Close()
+
+    server.setBody(rssFeed(jan2, jan1))
+    next := newTestBot(t, statePath, feedTable("show", server.URL))
+    if err := cliPostNew(next.FindFeed("show")); err != nil {
+        t.Fatal(err)
+    }
+    if threads := next.discord.Threads(); len(threads) != 1 || !strings.Contains(threads[0], "Episode 2") {
+        t.Fatalf("expected the next run to post Episode 2, got %v", threads)
+    }
+}
+
+func TestRegisterCommandsPerScope(t *testing.T) {
+    server := newFeedServer(t, rssFeed(jan1))
+    feedOption := func(cmds []*discordgo.ApplicationCommand) *discordgo.ApplicationCommandOption {
+        for _, cmd := range cmds {
+            for _, opt := range cmd.Options {
+                if opt.Name == "feed" {
+                    return opt
+                }
+            }
+        }
+        t.Fatal("no command has a feed option")
+        return nil
+    }
+
+    tb := newTestBot(t, filepath.Join(t.TempDir(), "state.json"), feedTable("show", server.URL))
+    registered, err := tb.UpDiscord()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if choices := feedOption(registered["guild"]).Choices; len(choices) != 1 || choices[0].Value != "show" {
+        t.Fatalf("expected the guild's one feed as the only choice, got %v", choices)
+    }
+    if choices := feedOption(commands).Choices; choices != nil {
+        t.Fatalf("registering changed the shared commands, feed choices %v", choices)
+    }
+
+    var feeds strings.Builder
+    for x := 0; x <= maxCommandChoices; x++ {
+        feeds.WriteString(feedTable(fmt.Sprintf("show%d", x), server.URL))
+    }
+    many := newTestBot(t, filepath.Join(t.TempDir(), "state.json"), feeds.String())
+    registered, err = many.UpDiscord()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if choices := feedOption(registered["guild"]).Choices; choices != nil {
+        t.Fatalf("expected no choices past discord's limit, got %d", len(choices))
+    }
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const DefaultFetchTimeout = 30
+const DefaultFetchMaxBodyBytes = 10 << 20
+const DefaultFetchRetryDelay = 2
+const DefaultUserAgent = "BasedCampBot/" + VERSION + " (+https://github.com/opsaaaaa/BasedCampBot)"
+const maxRetryAfter = 5 * time.Minute
+// maxRetryTime caps how long one request keeps retrying. Callers hold the feed's lock,
+// so commands wait on it, and their interaction has to be answered within 15 minutes.
+const maxRetryTime = 2 * time.Minute
+
+var ErrFeedTooLarge = errors.New("feed body is larger than Fetch.MaxBodyBytes")
+
+// HTTPStatusError is returned when the feed host answers with a non 2xx status.
+type HTTPStatusError struct {
+    Url string
+    StatusCode int
+    Status string
+    RetryAfter time.Duration
+}
+
+func (e *HTTPStatusError) Error() string {
+    return fmt.Sprintf("GET %s: %s", e.Url, e.Status)
+}
+
+// Temporary reports whether the request is worth retrying.
+func (e *HTTPStatusError) Temporary() bool {
+    switch e.StatusCode {
+    case http.StatusRequestTimeout, http.StatusTooEarly, http.StatusTooManyRequests:
+        return true
+    }
+    return e.StatusCode >= 500
+}
+
+// FeedClient wraps http.Client with the retry, size and status rules from [Fetch].
+type FeedClient struct {
+    client *http.Client
+    userAgent string
+    retries int
+    retryDelay time.Duration
+    maxBodyBytes int64
+}
+
+func NewFeedClient(c *Config) *FeedClient {
+    fetch := c.Fetch
+    return &FeedClient{
+        client: &http.Client{Timeout: time.Duration(fetch.Timeout) * time.Second},
+        userAgent: fetch.UserAgent,
+        retries: max(fetch.Retries, 0),
+        retryDelay: time.Duration(fetch.RetryDelay) * time.Second,
+        maxBodyBytes: fetch.MaxBodyBytes,
+    }
+}
+
+// Do sends the request, retrying network errors and temporary statuses with jittered backoff
+// for up to maxRetryTime.
+// A 2xx or 304 response is returned as is, anything else becomes an *HTTPStatusError.
+func (fc *FeedClient) Do(req *http.Request) (*http.Response, error) {
+    req.Header.Set("User-Agent", fc.userAgent)
+    start := time.Now()
+    var err error
+    for attempt := 0; attempt <= fc.retries; attempt++ {
+        var resp *http.Response
+        resp, err = fc.client.Do(req)
+        var wait time.Duration
+        if err == nil {
+            if resp.StatusCode == http.StatusNotModified || resp.StatusCode >= 200 && resp.StatusCode < 300 {
+                return resp, nil
+            }
+            statusErr := &HTTPStatusError{
+                Url: req.URL.String(),
+                StatusCode: resp.StatusCode,
+                Status: resp.Status,
+                RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+            }
+            resp.Body.Close()
+            if !statusErr.Temporary() {
+                return nil, statusErr
+            }
+            err = statusErr
+            wait = statusErr.RetryAfter
+        }
+        if attempt == fc.retries {
+            break
+        }
+        if wait == 0 {
+            wait = fc.backoff(attempt)
+        }
+        if time.Since(start)+wait > maxRetryTime {
+            logLvlF(LogDebug, "Feed request attempt %d/%d failed: %v, not waiting %v to retry", attempt+1, fc.retries+1, err, wait)
+            break
+        }
+        logLvlF(LogDebug, "Feed request attempt %d/%d failed: %v, retrying in %v", attempt+1, fc.retries+1, err, wait)
+        time.Sleep(wait)
+    }
+    return nil, err
+}
+
+// ReadBody reads the response body, failing with ErrFeedTooLarge past the size cap.
+func (fc *FeedClient) ReadBody(resp *http.Response) ([]byte, error) {
+    body, err := io.ReadAll(io.LimitReader(resp.Body, fc.maxBodyBytes+1))
+    if err != nil {
+        return nil, err
+    }
+    if int64(len(body)) > fc.maxBodyBytes {
+        return nil, ErrFeedTooLarge
+    }
+    return body, nil
+}
+
+// backoff doubles the delay each attempt, picking a random point in its upper half.
+func (fc *FeedClient) backoff(attempt int) time.Duration {
+    delay := fc.retryDelay * time.Duration(1<<uint(attempt))
+    return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// parseRetryAfter reads a Retry-After header in either seconds or HTTP date form.
+func parseRetryAfter(value string) time.Duration {
+    if value == "" {
+        return 0
+    }
+    var wait time.Duration
+    if seconds, err := strconv.Atoi(value); err == nil {
+        wait = time.Duration(seconds) * time.Second
+    } else if date, err := http.ParseTime(value); err == nil {
+        wait = time.Until(date)
+    }
+    if wait < 0 {
+        return 0
+    }
+    return min(wait, maxRetryAfter)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestFeedClient(retries int) *FeedClient {
+    c := &Config{}
+    c.Fetch.Timeout = 5
+    c.Fetch.MaxBodyBytes = 1 << 10
+    c.Fetch.Retries = retries
+    c.Fetch.UserAgent = "test-agent"
+    return NewFeedClient(c)
+}
+
+// statusServer answers with each of statuses in turn, then 200.
+func statusServer(t *testing.T, retryAfter string, statuses ...int) (*httptest.Server, *atomic.Int32) {
+    var requests atomic.Int32
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        n := int(requests.Add(1))
+        if r.Header.Get("User-Agent") != "test-agent" {
+            t.Errorf("unexpected User-Agent %q", r.Header.Get("User-Agent"))
+        }
+        if n <= len(statuses) {
+            w.Header().Set("Retry-After", retryAfter)
+            w.WriteHeader(statuses[n-1])
+            return
+        }
+        w.Write([]byte("ok"))
+    }))
+    t.Cleanup(srv.Close)
+    return srv, &requests
+}
+
+func TestFeedClientRetriesUnavailable(t *testing.T) {
+    srv, requests := statusServer(t, "1", http.StatusServiceUnavailable)
+    fc := newTestFeedClient(2)
+    req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+    start := time.Now()
+    resp, err := fc.Do(req)
+    if err != nil {
+        t.Fatal(err)
+    }
+    body, err := fc.ReadBody(resp)
+    resp.Body.Close()
+    if err != nil || string(body) != "ok" {
+        t.Fatalf("unexpected body %q, %v", body, err)
+    }
+    if requests.Load() != 2 {
+        t.Fatalf("expected 2 requests, got %d", requests.Load())
+    }
+    if waited := time.Since(start); waited < time.Second {
+        t.Fatalf("expected to wait out the 1 second Retry-After, waited %v", waited)
+    }
+}
+
+func TestFeedClientGivesUp(t *testing.T) {
+    tests := []struct {
+        name string
+        statuses []int
+        retries int
+        wantRequests int32
+        wantStatus int
+    }{
+        {"not found isn't retried", []int{http.StatusNotFound}, 2, 1, http.StatusNotFound},
+        {"out of retries", []int{http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable}, 2, 3, http.StatusServiceUnavailable},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            srv, requests := statusServer(t, "0", tt.statuses...)
+            req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+            _, err := newTestFeedClient(tt.retries).Do(req)
+            var statusErr *HTTPStatusError
+            if !errors.As(err, &statusErr) || statusErr.StatusCode != tt.wantStatus {
+                t.Fatalf("expected a %d HTTPStatusError, got %v", tt.wantStatus, err)
+            }
+            if requests.Load() != tt.wantRequests {
+                t.Fatalf("expected %d requests, got %d", tt.wantRequests, requests.Load())
+            }
+        })
+    }
+}
+
+func TestFeedClientBodyLimit(t *testing.T) {
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.Write(make([]byte, 2<<10))
+    }))
+    defer srv.Close()
+    fc := newTestFeedClient(0)
+    req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+    resp, err := fc.Do(req)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer resp.Body.Close()
+    if _, err := fc.ReadBody(resp); !errors.Is(err, ErrFeedTooLarge) {
+        t.Fatalf("expected ErrFeedTooLarge, got %v", err)
+    }
+}
+
+func TestParseRetryAfter(t *testing.T) {
+    date := func(d time.Duration) string {
+        return time.Now().Add(d).UTC().Format(http.TimeFormat)
+    }
+    tests := []struct {
+        value string
+        min time.Duration
+        max time.Duration
+    }{
+        {"", 0, 0},
+        {"junk", 0, 0},
+        {"-5", 0, 0},
+        {"0", 0, 0},
+        {"120", 2 * time.Minute, 2 * time.Minute},
+        {"86400", maxRetryAfter, maxRetryAfter},
+        {date(-time.Hour), 0, 0},
+        {date(time.Minute), 58 * time.Second, time.Minute},
+        {date(time.Hour), maxRetryAfter, maxRetryAfter},
+    }
+    for _, tt := range tests {
+        if got := parseRetryAfter(tt.value); got < tt.min || got > tt.max {
+            t.Errorf("parseRetryAfter(%q) = %v, want between %v and %v", tt.value, got, tt.min, tt.max)
+        }
+    }
+}
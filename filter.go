@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// ItemFilter is a feed's [Filter] config compiled, it decides which new items get posted.
+type ItemFilter struct {
+    titleInclude []*regexp.Regexp
+    titleExclude []*regexp.Regexp
+    descriptionInclude []*regexp.Regexp
+    descriptionExclude []*regexp.Regexp
+    categories []string
+    excludeCategories []string
+    authors []string
+    excludeAuthors []string
+    minDuration time.Duration
+    maxDuration time.Duration
+    excludeShorts bool
+}
+
+func NewItemFilter(cfg FilterConfig) (*ItemFilter, error) {
+    f := &ItemFilter{
+        categories: lowerAll(cfg.Categories),
+        excludeCategories: lowerAll(cfg.ExcludeCategories),
+        authors: lowerAll(cfg.Authors),
+        excludeAuthors: lowerAll(cfg.ExcludeAuthors),
+        excludeShorts: cfg.ExcludeShorts,
+    }
+    var err error
+    if f.titleInclude, err = compilePatterns("TitleInclude", cfg.TitleInclude); err != nil {
+        return nil, err
+    }
+    if f.titleExclude, err = compilePatterns("TitleExclude", cfg.TitleExclude); err != nil {
+        return nil, err
+    }
+    if f.descriptionInclude, err = compilePatterns("DescriptionInclude", cfg.DescriptionInclude); err != nil {
+        return nil, err
+    }
+    if f.descriptionExclude, err = compilePatterns("DescriptionExclude", cfg.DescriptionExclude); err != nil {
+        return nil, err
+    }
+    if cfg.MinDuration != "" {
+        if f.minDuration, err = time.ParseDuration(cfg.MinDuration); err != nil {
+            return nil, fmt.Errorf("MinDuration: %w", err)
+        }
+    }
+    if cfg.MaxDuration != "" {
+        if f.maxDuration, err = time.ParseDuration(cfg.MaxDuration); err != nil {
+            return nil, fmt.Errorf("MaxDuration: %w", err)
+        }
+    }
+    if f.maxDuration > 0 && f.minDuration > f.maxDuration {
+        return nil, fmt.Errorf("MinDuration %v is longer than MaxDuration %v", f.minDuration, f.maxDuration)
+    }
+    return f, nil
+}
+
+func compilePatterns(name string, patterns []string) ([]*regexp.Regexp, error) {
+    compiled := make([]*regexp.Regexp, 0, len(patterns))
+    for _, pattern := range patterns {
+        re, err := regexp.Compile(pattern)
+        if err != nil {
+            return nil, fmt.Errorf("%s: %w", name, err)
+        }
+        compiled = append(compiled, re)
+    }
+    return compiled, nil
+}
+
+func lowerAll(s []string) []string {
+    lower := make([]string, len(s))
+    for x := range s {
+        lower[x] = strings.ToLower(strings.TrimSpace(s[x]))
+    }
+    return lower
+}
+
+// Check returns why the item is filtered out, or "" when it should be posted.
+func (f *ItemFilter) Check(feed *gofeed.Feed, item *gofeed.Item) string {
+    if f.excludeShorts && isYouTubeShort(item) {
+        return "it is a YouTube Short"
+    }
+    if reason := checkPatterns("title", item.Title, f.titleInclude, f.titleExclude); reason != "" {
+        return reason
+    }
+    if reason := checkPatterns("description", item.Description, f.descriptionInclude, f.descriptionExclude); reason != "" {
+        return reason
+    }
+    categories := lowerAll(item.Categories)
+    if len(f.categories) > 0 && !containsAny(categories, f.categories) {
+        return "it has none of the categories " + strings.Join(f.categories, ", ")
+    }
+    for _, category := range categories {
+        if slices.Contains(f.excludeCategories, category) {
+            return "it has the excluded category " + category
+        }
+    }
+    authors := lowerAll(itemAuthors(feed, item))
+    if len(f.authors) > 0 && !containsAny(authors, f.authors) {
+        return "it isn't by " + strings.Join(f.authors, ", ")
+    }
+    for _, author := range authors {
+        if slices.Contains(f.excludeAuthors, author) {
+            return "it is by the excluded author " + author
+        }
+    }
+    // Feeds that don't say how long an item is can't be filtered on it.
+    if duration := itemDuration(item); duration > 0 {
+        if f.minDuration > 0 && duration < f.minDuration {
+            return fmt.Sprintf("it is %v, shorter than %v", duration, f.minDuration)
+        }
+        if f.maxDuration > 0 && duration > f.maxDuration {
+            return fmt.Sprintf("it is %v, longer than %v", duration, f.maxDuration)
+        }
+    }
+    return ""
+}
+
+// checkPatterns wants text to match one of include, when there are any, and none of exclude.
+func checkPatterns(field string, text string, include []*regexp.Regexp, exclude []*regexp.Regexp) string {
+    if len(include) > 0 && !slices.ContainsFunc(include, func(re *regexp.Regexp) bool { return re.MatchString(text) }) {
+        return fmt.Sprintf("its %s matches none of the include patterns", field)
+    }
+    for _, re := range exclude {
+        if re.MatchString(text) {
+            return fmt.Sprintf("its %s matches the exclude pattern `%s`", field, re)
+        }
+    }
+    return ""
+}
+
+func containsAny(have []string, want []string) bool {
+    return slices.ContainsFunc(have, func(s string) bool { return slices.Contains(want, s) })
+}
+
+// itemAuthors lists every author name on the item, falling back to the feed's author.
+func itemAuthors(feed *gofeed.Feed, item *gofeed.Item) []string {
+    names := []string{}
+    for _, author := range item.Authors {
+        if author != nil && author.Name != "" {
+            names = append(names, author.Name)
+        }
+    }
+    if len(names) == 0 {
+        if author := itemAuthor(feed, item); author != "" {
+            names = append(names, author)
+        }
+    }
+    return names
+}
+
+// isYouTubeShort spots Shorts by their link, YouTube's feed links them to /shorts/ instead of /watch.
+func isYouTubeShort(item *gofeed.Item) bool {
+    links := append([]string{item.Link}, item.Links...)
+    for _, link := range links {
+        u, err := url.Parse(link)
+        if err != nil {
+            continue
+        }
+        if strings.HasSuffix(u.Hostname(), "youtube.com") && strings.HasPrefix(u.Path, "/shorts/") {
+            return true
+        }
+    }
+    return false
+}
+
+// itemDuration reads the item's length from itunes:duration or a media:content duration,
+// 0 when the feed doesn't say.
+func itemDuration(item *gofeed.Item) time.Duration {
+    if item.ITunesExt != nil && item.ITunesExt.Duration != "" {
+        if d := parseClockDuration(item.ITunesExt.Duration); d > 0 {
+            return d
+        }
+    }
+    if media, ok := item.Extensions["media"]; ok {
+        contents := media["content"]
+        for _, group := range media["group"] {
+            contents = append(contents, group.Children["content"]...)
+        }
+        for _, content := range contents {
+            if seconds, err := strconv.ParseFloat(content.Attrs["duration"], 64); err == nil && seconds > 0 {
+                return time.Duration(seconds * float64(time.Second))
+            }
+        }
+    }
+    return 0
+}
+
+// parseClockDuration reads "1:02:03", "62:03" or plain seconds "3723".
+func parseClockDuration(s string) time.Duration {
+    var seconds float64
+    for _, part := range strings.Split(strings.TrimSpace(s), ":") {
+        n, err := strconv.ParseFloat(part, 64)
+        if err != nil || n < 0 {
+            return 0
+        }
+        seconds = seconds*60 + n
+    }
+    return time.Duration(seconds * float64(time.Second))
+}
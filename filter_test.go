@@ -0,0 +1,105 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	ext "github.com/mmcdole/gofeed/extensions"
+)
+
+func TestItemFilterCheck(t *testing.T) {
+    feedAuthor := &gofeed.Person{Name: "Feed Author"}
+    feed := &gofeed.Feed{Author: feedAuthor, Authors: []*gofeed.Person{feedAuthor}}
+    video := &gofeed.Item{
+        Title: "Weekly Update #12",
+        Description: "News from the camp",
+        Link: "https://www.youtube.com/watch?v=abc",
+        Categories: []string{"News", "Camping"},
+    }
+    short := &gofeed.Item{Title: "Quick tip", Link: "https://www.youtube.com/shorts/abc"}
+    byGuest := &gofeed.Item{Title: "Guest post", Authors: []*gofeed.Person{{Name: "Guest"}}}
+    episode := &gofeed.Item{Title: "Episode 3", ITunesExt: &ext.ITunesItemExtension{Duration: "1:02:03"}}
+    clip := &gofeed.Item{Title: "Clip", Extensions: ext.Extensions{"media": {
+        "group": {{Children: map[string][]ext.Extension{
+            "content": {{Attrs: map[string]string{"duration": "45"}}},
+        }}},
+    }}}
+    undated := &gofeed.Item{Title: "No length"}
+
+    tests := []struct {
+        name string
+        cfg FilterConfig
+        item *gofeed.Item
+        want string
+    }{
+        {"no rules", FilterConfig{}, video, ""},
+        {"title include matches", FilterConfig{TitleInclude: []string{`(?i)update`}}, video, ""},
+        {"title include misses", FilterConfig{TitleInclude: []string{`livestream`}}, video, "title matches none"},
+        {"title exclude", FilterConfig{TitleExclude: []string{`#\d+`}}, video, "exclude pattern `#\\d+`"},
+        {"description include misses", FilterConfig{DescriptionInclude: []string{`sale`}}, video, "description matches none"},
+        {"description exclude", FilterConfig{DescriptionExclude: []string{`camp`}}, video, "description matches the exclude"},
+        {"category ignores case", FilterConfig{Categories: []string{" news "}}, video, ""},
+        {"category missing", FilterConfig{Categories: []string{"reviews"}}, video, "none of the categories reviews"},
+        {"category excluded", FilterConfig{ExcludeCategories: []string{"CAMPING"}}, video, "excluded category camping"},
+        {"feed author fallback", FilterConfig{Authors: []string{"feed author"}}, video, ""},
+        {"item author", FilterConfig{Authors: []string{"feed author"}}, byGuest, "isn't by feed author"},
+        {"author excluded", FilterConfig{ExcludeAuthors: []string{"guest"}}, byGuest, "excluded author guest"},
+        {"shorts excluded", FilterConfig{ExcludeShorts: true}, short, "YouTube Short"},
+        {"shorts allowed", FilterConfig{}, short, ""},
+        {"videos kept", FilterConfig{ExcludeShorts: true}, video, ""},
+        {"itunes too long", FilterConfig{MaxDuration: "1h"}, episode, "1h2m3s, longer than 1h0m0s"},
+        {"itunes in range", FilterConfig{MinDuration: "1h", MaxDuration: "2h"}, episode, ""},
+        {"media group too short", FilterConfig{MinDuration: "1m"}, clip, "45s, shorter than 1m0s"},
+        {"unknown length kept", FilterConfig{MinDuration: "1m", MaxDuration: "2m"}, undated, ""},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            f, err := NewItemFilter(tt.cfg)
+            if err != nil {
+                t.Fatal(err)
+            }
+            got := f.Check(feed, tt.item)
+            if tt.want == "" && got != "" || !strings.Contains(got, tt.want) {
+                t.Fatalf("Check() = %q, want %q", got, tt.want)
+            }
+        })
+    }
+}
+
+func TestNewItemFilterErrors(t *testing.T) {
+    tests := []struct {
+        cfg FilterConfig
+        want string
+    }{
+        {FilterConfig{TitleInclude: []string{`(`}}, "TitleInclude"},
+        {FilterConfig{DescriptionExclude: []string{`[`}}, "DescriptionExclude"},
+        {FilterConfig{MinDuration: "ten minutes"}, "MinDuration"},
+        {FilterConfig{MaxDuration: "5"}, "MaxDuration"},
+        {FilterConfig{MinDuration: "1h", MaxDuration: "10m"}, "longer than MaxDuration"},
+    }
+    for _, tt := range tests {
+        _, err := NewItemFilter(tt.cfg)
+        if err == nil || !strings.Contains(err.Error(), tt.want) {
+            t.Errorf("NewItemFilter(%+v) = %v, want an error about %s", tt.cfg, err, tt.want)
+        }
+    }
+}
+
+func TestParseClockDuration(t *testing.T) {
+    tests := map[string]time.Duration{
+        "1:02:03": time.Hour + 2*time.Minute + 3*time.Second,
+        "62:03": 62*time.Minute + 3*time.Second,
+        "3723": time.Hour + 2*time.Minute + 3*time.Second,
+        " 90.5 ": 90500 * time.Millisecond,
+        "": 0,
+        "1:xx": 0,
+        "-5": 0,
+    }
+    for in, want := range tests {
+        if got := parseClockDuration(in); got != want {
+            t.Errorf("parseClockDuration(%q) = %v, want %v", in, got, want)
+        }
+    }
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+
+	nethtml "golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+const DescriptionMarkdown = "markdown"
+const DescriptionText = "text"
+const DescriptionRaw = "raw"
+
+var (
+    htmlTagPattern = regexp.MustCompile(`<(?i:[a-z][a-z0-9]*)(\s[^>]*)?/?>|</(?i:[a-z][a-z0-9]*)>`)
+    spacePattern = regexp.MustCompile(`[ \t\r\f\v\x{a0}]+`)
+    whitespacePattern = regexp.MustCompile(`\s+`)
+    trailingSpacePattern = regexp.MustCompile(`[ \t]+\n`)
+    blankLinesPattern = regexp.MustCompile(`\n{3,}`)
+)
+
+// SanitizeDescription prepares a feed description for discord.
+// mode is one of DescriptionMarkdown (the default), DescriptionText or DescriptionRaw.
+func SanitizeDescription(description string, mode string) string {
+    switch mode {
+    case DescriptionRaw:
+        return description
+    case DescriptionText:
+        if !htmlTagPattern.MatchString(description) {
+            return cleanPlainText(description)
+        }
+        return cleanPlainText(stripHTML(description))
+    default:
+        if !htmlTagPattern.MatchString(description) {
+            return cleanPlainText(description)
+        }
+        return HTMLToMarkdown(description)
+    }
+}
+
+// cleanPlainText decodes entities and collapses spaces, keeping the line breaks
+// plain text descriptions (like YouTube's) rely on.
+func cleanPlainText(s string) string {
+    s = html.UnescapeString(s)
+    s = spacePattern.ReplaceAllString(s, " ")
+    return tidyMarkdown(s)
+}
+
+func tidyMarkdown(s string) string {
+    s = trailingSpacePattern.ReplaceAllString(s, "\n")
+    s = blankLinesPattern.ReplaceAllString(s, "\n\n")
+    return strings.TrimSpace(s)
+}
+
+// HTMLToMarkdown converts HTML show notes into discord flavored markdown.
+// Images, scripts and other non text content is dropped.
+func HTMLToMarkdown(s string) string {
+    nodes, err := nethtml.ParseFragment(strings.NewReader(s), &nethtml.Node{
+        Type: nethtml.ElementNode,
+        Data: "body",
+        DataAtom: atom.Body,
+    })
+    if err != nil {
+        return cleanPlainText(stripHTML(s))
+    }
+    md := &markdownWriter{}
+    for _, n := range nodes {
+        md.node(n)
+    }
+    return tidyMarkdown(md.sb.String())
+}
+
+type markdownWriter struct {
+    sb strings.Builder
+    listDepth int
+    pre bool
+}
+
+func (md *markdownWriter) atLineStart() bool {
+    s := md.sb.String()
+    return len(s) == 0 || strings.HasSuffix(s, "\n")
+}
+
+func (md *markdownWriter) text(s string) {
+    if md.pre {
+        md.sb.WriteString(s)
+        return
+    }
+    s = whitespacePattern.ReplaceAllString(s, " ")
+    if md.atLineStart() || strings.HasSuffix(md.sb.String(), " ") {
+        s = strings.TrimLeft(s, " ")
+    }
+    md.sb.WriteString(s)
+}
+
+func (md *markdownWriter) newline() {
+    if !strings.HasSuffix(md.sb.String(), "\n") {
+        md.sb.WriteString("\n")
+    }
+}
+
+func (md *markdownWriter) paragraph() {
+    if md.sb.Len() == 0 {
+        return
+    }
+    md.newline()
+    if md.listDepth == 0 && !strings.HasSuffix(md.sb.String(), "\n\n") {
+        md.sb.WriteString("\n")
+    }
+}
+
+func (md *markdownWriter) children(n *nethtml.Node) {
+    for c := n.FirstChild; c != nil; c = c.NextSibling {
+        md.node(c)
+    }
+}
+
+// inline renders the children on their own so they can be wrapped in markers.
+func (md *markdownWriter) inline(n *nethtml.Node) string {
+    sub := &markdownWriter{listDepth: md.listDepth, pre: md.pre}
+    sub.children(n)
+    return strings.TrimSpace(sub.sb.String())
+}
+
+func (md *markdownWriter) wrap(n *nethtml.Node, marker string) {
+    inner := md.inline(n)
+    if inner == "" {
+        return
+    }
+    md.sb.WriteString(marker + inner + marker)
+}
+
+func (md *markdownWriter) node(n *nethtml.Node) {
+    switch n.Type {
+    case nethtml.TextNode:
+        md.text(n.Data)
+        return
+    case nethtml.ElementNode:
+    default:
+        md.children(n)
+        return
+    }
+
+    switch n.DataAtom {
+    case atom.Script, atom.Style, atom.Img, atom.Picture, atom.Video, atom.Audio,
+        atom.Iframe, atom.Object, atom.Embed, atom.Svg, atom.Noscript, atom.Head, atom.Template:
+        return
+    case atom.Br:
+        md.sb.WriteString("\n")
+    case atom.Hr:
+        md.paragraph()
+        md.sb.WriteString("───\n")
+    case atom.P, atom.Div, atom.Section, atom.Article, atom.Table, atom.Tr:
+        md.paragraph()
+        md.children(n)
+        md.paragraph()
+    case atom.H1, atom.H2, atom.H3:
+        md.paragraph()
+        inner := md.inline(n)
+        if inner != "" {
+            md.sb.WriteString(strings.Repeat("#", int(n.Data[1]-'0')) + " " + inner)
+        }
+        md.paragraph()
+    case atom.H4, atom.H5, atom.H6:
+        md.paragraph()
+        md.wrap(n, "**")
+        md.paragraph()
+    case atom.B, atom.Strong:
+        md.wrap(n, "**")
+    case atom.I, atom.Em:
+        md.wrap(n, "*")
+    case atom.U:
+        md.wrap(n, "__")
+    case atom.S, atom.Strike, atom.Del:
+        md.wrap(n, "~~")
+    case atom.Code:
+        if md.pre {
+            md.children(n)
+        } else {
+            md.wrap(n, "`")
+        }
+    case atom.Pre:
+        md.paragraph()
+        md.sb.WriteString("```\n")
+        md.pre = true
+        md.children(n)
+        md.pre = false
+        md.newline()
+        md.sb.WriteString("```")
+        md.paragraph()
+    case atom.Blockquote:
+        md.paragraph()
+        inner := (&markdownWriter{}).convert(n)
+        for _, line := range strings.Split(inner, "\n") {
+            md.sb.WriteString("> " + line + "\n")
+        }
+        md.paragraph()
+    case atom.Ul, atom.Ol:
+        if md.listDepth == 0 {
+            md.paragraph()
+        } else {
+            md.newline()
+        }
+        md.listDepth++
+        x := 0
+        for c := n.FirstChild; c != nil; c = c.NextSibling {
+            if c.Type != nethtml.ElementNode || c.DataAtom != atom.Li {
+                continue
+            }
+            x++
+            md.newline()
+            md.sb.WriteString(strings.Repeat("  ", md.listDepth-1))
+            if n.DataAtom == atom.Ol {
+                md.sb.WriteString(fmt.Sprintf("%d. ", x))
+            } else {
+                md.sb.WriteString("- ")
+            }
+            md.children(c)
+        }
+        md.listDepth--
+        if md.listDepth == 0 {
+            md.paragraph()
+        } else {
+            md.newline()
+        }
+    case atom.A:
+        href := ""
+        for _, attr := range n.Attr {
+            if attr.Key == "href" {
+                href = strings.TrimSpace(attr.Val)
+            }
+        }
+        inner := md.inline(n)
+        if !strings.HasPrefix(href, "http://") && !strings.HasPrefix(href, "https://") {
+            md.text(inner)
+        } else if inner == "" || inner == href {
+            md.text(" " + href)
+        } else {
+            md.text(" ")
+            md.sb.WriteString("[" + strings.ReplaceAll(inner, "]", "\\]") + "](" + href + ")")
+        }
+    default:
+        md.children(n)
+    }
+}
+
+func (md *markdownWriter) convert(n *nethtml.Node) string {
+    md.children(n)
+    return tidyMarkdown(md.sb.String())
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+    metricFeedFetches = newMetricVec("counter", "basedcamp_feed_fetches_total", "Feed requests by result.", "feed", "result")
+    metricParseFailures = newMetricVec("counter", "basedcamp_feed_parse_failures_total", "Feed bodies that failed to parse.", "feed")
+    metricPostsCreated = newMetricVec("counter", "basedcamp_posts_created_total", "Forum threads created.", "feed", "guild")
+    metricNotifyFailures = newMetricVec("counter", "basedcamp_notify_failures_total", "Notify messages that failed to send.", "feed", "guild")
+    metricCommands = newMetricVec("counter", "basedcamp_command_invocations_total", "Slash commands run.", "command")
+    metricLastFetch = newMetricVec("gauge", "basedcamp_last_fetch_success_timestamp_seconds", "Unix time of the last successful feed fetch.", "feed")
+    metricLastPublished = newMetricVec("gauge", "basedcamp_last_published_timestamp_seconds", "Unix time of the last posted item.", "feed")
+    metricNextRun = newMetricVec("gauge", "basedcamp_next_run_timestamp_seconds", "Unix time of the next scheduled feed check.", "feed")
+    metricDiscordConnected = newMetricVec("gauge", "basedcamp_discord_connected", "1 while the discord gateway is connected.")
+    metricBuildInfo = newMetricVec("gauge", "basedcamp_build_info", "Always 1, labeled with the bot version.", "version")
+
+    allMetrics = []*metricVec{
+        metricFeedFetches,
+        metricParseFailures,
+        metricPostsCreated,
+        metricNotifyFailures,
+        metricCommands,
+        metricLastFetch,
+        metricLastPublished,
+        metricNextRun,
+        metricDiscordConnected,
+        metricBuildInfo,
+    }
+)
+
+// metricVec is a prometheus counter or gauge with a set of labels.
+type metricVec struct {
+    kind string
+    name string
+    help string
+    labels []string
+    mu sync.Mutex
+    values map[string]float64
+}
+
+func newMetricVec(kind string, name string, help string, labels ...string) *metricVec {
+    return &metricVec{
+        kind: kind,
+        name: name,
+        help: help,
+        labels: labels,
+        values: make(map[string]float64),
+    }
+}
+
+func (m *metricVec) Add(v float64, labelValues ...string) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    m.values[strings.Join(labelValues, "\xff")] += v
+}
+
+func (m *metricVec) Inc(labelValues ...string) {
+    m.Add(1, labelValues...)
+}
+
+func (m *metricVec) Set(v float64, labelValues ...string) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    m.values[strings.Join(labelValues, "\xff")] = v
+}
+
+func (m *metricVec) Get(labelValues ...string) float64 {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    return m.values[strings.Join(labelValues, "\xff")]
+}
+
+func (m *metricVec) write(w io.Writer) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+    keys := make([]string, 0, len(m.values))
+    for key := range m.values {
+        keys = append(keys, key)
+    }
+    sort.Strings(keys)
+    for _, key := range keys {
+        fmt.Fprintf(w, "%s%s %v\n", m.name, m.formatLabels(key), m.values[key])
+    }
+}
+
+func (m *metricVec) formatLabels(key string) string {
+    if len(m.labels) == 0 {
+        return ""
+    }
+    values := strings.Split(key, "\xff")
+    pairs := make([]string, len(m.labels))
+    for x, label := range m.labels {
+        val := ""
+        if x < len(values) {
+            val = values[x]
+        }
+        val = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(val)
+        pairs[x] = fmt.Sprintf(`%s="%s"`, label, val)
+    }
+    return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// collectGauges refreshes the gauges that are read from the feeds at scrape time.
+func (b *Bot) collectGauges() {
+    for _, fw := range b.Feeds() {
+        metricLastPublished.Set(float64(fw.state.LastPublished().Unix()), fw.Name())
+        if fw.job != nil {
+            if nextRun, err := fw.job.NextRun(); err == nil {
+                metricNextRun.Set(float64(nextRun.Unix()), fw.Name())
+            }
+        }
+    }
+    if b.connected.Load() {
+        metricDiscordConnected.Set(1)
+    } else {
+        metricDiscordConnected.Set(0)
+    }
+    metricBuildInfo.Set(1, VERSION)
+}
+
+func (b *Bot) StartStatusServer(listen string) {
+    mux := http.NewServeMux()
+    mux.HandleFunc("/healthz", b.handleHealthz)
+    mux.HandleFunc("/readyz", b.handleReadyz)
+    mux.HandleFunc("/metrics", b.handleMetrics)
+    server := &http.Server{
+        Addr: listen,
+        Handler: mux,
+        ReadHeaderTimeout: 10 * time.Second,
+    }
+    go func() {
+        logLvlLn(LogProd, "Status server listening on", listen)
+        err := server.ListenAndServe()
+        if err != nil && err != http.ErrServerClosed {
+            logLvlLn(LogProd, "Error running status server.", err)
+        }
+    }()
+}
+
+func (b *Bot) handleHealthz(w http.ResponseWriter, r *http.Request) {
+    status := struct {
+        Discord bool `json:"discord"`
+        LastFetch map[string]time.Time `json:"lastFetch"`
+    }{
+        Discord: b.connected.Load(),
+        LastFetch: make(map[string]time.Time, len(b.Feeds())),
+    }
+    for _, fw := range b.Feeds() {
+        status.LastFetch[fw.Name()] = time.Unix(int64(metricLastFetch.Get(fw.Name())), 0)
+    }
+    w.Header().Set("Content-Type", "application/json")
+    if !status.Discord {
+        w.WriteHeader(http.StatusServiceUnavailable)
+    }
+    _ = json.NewEncoder(w).Encode(status)
+}
+
+func (b *Bot) handleReadyz(w http.ResponseWriter, r *http.Request) {
+    if !b.ready.Load() {
+        http.Error(w, "starting", http.StatusServiceUnavailable)
+        return
+    }
+    fmt.Fprintln(w, "ready")
+}
+
+func (b *Bot) handleMetrics(w http.ResponseWriter, r *http.Request) {
+    b.collectGauges()
+    w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+    for _, m := range allMetrics {
+        m.write(w)
+    }
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// defaultCommandPermissions keeps the commands that post or show the config
+// to server managers unless [Permissions] says otherwise.
+var defaultCommandPermissions = map[string]int64{
+    "checkconfig": discordgo.PermissionManageServer,
+    "postlatest": discordgo.PermissionManageServer,
+    "postnew": discordgo.PermissionManageServer,
+}
+
+// CommandPermissions returns the configured permissions for a command, filling in the defaults.
+func (c *Config) CommandPermissions(name string) CommandPermissions {
+    perms := c.Permissions[name]
+    if perms.DefaultMemberPermissions == nil {
+        if bits, ok := defaultCommandPermissions[name]; ok {
+            perms.DefaultMemberPermissions = &bits
+        }
+    }
+    return perms
+}
+
+// checkPermissions returns why the invoking user may not run the command,
+// or an empty string when they can.
+func (b *Bot) checkPermissions(name string, i *discordgo.InteractionCreate) string {
+    perms := b.Config().CommandPermissions(name)
+    if perms.DefaultMemberPermissions != nil && *perms.DefaultMemberPermissions != 0 {
+        need := *perms.DefaultMemberPermissions
+        if i.Member == nil {
+            return fmt.Sprintf("`/%s` can only be used in a server.", name)
+        }
+        if i.Member.Permissions&discordgo.PermissionAdministrator == 0 && i.Member.Permissions&need != need {
+            return fmt.Sprintf("You don't have the server permissions needed to use `/%s`.", name)
+        }
+    }
+    if len(perms.Roles) == 0 && len(perms.Users) == 0 {
+        return ""
+    }
+    if user := interactionUser(i); user != nil && slices.Contains(perms.Users, user.ID) {
+        return ""
+    }
+    if i.Member != nil {
+        for _, role := range i.Member.Roles {
+            if slices.Contains(perms.Roles, role) {
+                return ""
+            }
+        }
+    }
+    return fmt.Sprintf("`/%s` is limited to certain roles and users.", name)
+}
+
+// interactionUser is whoever ran the interaction, in a server or a DM.
+func interactionUser(i *discordgo.InteractionCreate) *discordgo.User {
+    if i.Member != nil && i.Member.User != nil {
+        return i.Member.User
+    }
+    return i.User
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/mmcdole/gofeed"
+)
+
+const DefaultPodcastTitleTemplate = `{{.Podcast.Title}}`
+const DefaultPodcastBodyTemplate = `{{range .Item.Links}}{{.}}
+{{end}}{{with .Podcast}}{{if .AudioURL}}Listen: {{.AudioURL}}
+{{end}}{{if .Duration}}Length: {{.DurationText}}{{if .Explicit}}, explicit{{end}}
+{{end}}{{end}}{{.Description}}
+{{with .Podcast.Image}}{{.}}{{end}}`
+
+// PodcastEpisode is what a podcast feed's enclosure and itunes: tags say about an item,
+// as .Podcast in the templates.
+type PodcastEpisode struct {
+    // Title is the episode title with its code in front, like "S2E14 — Title".
+    Title string
+    // Code is "S2E14", "E14" or "" when the feed doesn't number its episodes.
+    Code string
+    Season int
+    Episode int
+    // EpisodeType is "full", "trailer" or "bonus".
+    EpisodeType string
+    AudioURL string
+    AudioType string
+    AudioBytes int64
+    Duration time.Duration
+    // DurationText is the duration as "1:02:03".
+    DurationText string
+    Explicit bool
+    // Image is the episode artwork, or the show's when the episode has none.
+    Image string
+}
+
+// podcastSource reads the enclosure and itunes: tags of a podcast RSS feed.
+type podcastSource struct{}
+
+// Parse gives items without an image the episode or show artwork, so embeds show it.
+func (podcastSource) Parse(body []byte) (*gofeed.Feed, error) {
+    feed, err := parseFeedAs(FeedTypeRSS, body)
+    if err != nil {
+        return nil, err
+    }
+    for _, item := range feed.Items {
+        if item.Image == nil {
+            if image := podcastImage(feed, item); image != "" {
+                item.Image = &gofeed.Image{URL: image}
+            }
+        }
+    }
+    return feed, nil
+}
+
+func (podcastSource) Extend(data *TemplateData) {
+    data.Podcast = podcastEpisode(data.Feed, data.Item)
+}
+
+func podcastEpisode(feed *gofeed.Feed, item *gofeed.Item) *PodcastEpisode {
+    episode := &PodcastEpisode{
+        Title: item.Title,
+        Image: podcastImage(feed, item),
+        Duration: itemDuration(item),
+    }
+    // itunes:title leaves out the numbering some shows put in the item title.
+    if title := extensionValue(item, "itunes", "title"); title != "" {
+        episode.Title = title
+    }
+    if itunes := item.ITunesExt; itunes != nil {
+        episode.Season, _ = strconv.Atoi(strings.TrimSpace(itunes.Season))
+        episode.Episode, _ = strconv.Atoi(strings.TrimSpace(itunes.Episode))
+        episode.EpisodeType = strings.ToLower(strings.TrimSpace(itunes.EpisodeType))
+        explicit := strings.ToLower(strings.TrimSpace(itunes.Explicit))
+        episode.Explicit = explicit == "yes" || explicit == "true" || explicit == "explicit"
+    }
+    if episode.Episode > 0 {
+        episode.Code = fmt.Sprintf("E%d", episode.Episode)
+        if episode.Season > 0 {
+            episode.Code = fmt.Sprintf("S%d%s", episode.Season, episode.Code)
+        }
+        episode.Title = episode.Code + " — " + episode.Title
+    }
+    for _, enclosure := range item.Enclosures {
+        if enclosure == nil || enclosure.URL == "" {
+            continue
+        }
+        // Prefer the audio, but take whatever is there when nothing says it is audio.
+        if episode.AudioURL == "" || strings.HasPrefix(enclosure.Type, "audio/") && !strings.HasPrefix(episode.AudioType, "audio/") {
+            episode.AudioURL = enclosure.URL
+            episode.AudioType = enclosure.Type
+            episode.AudioBytes, _ = strconv.ParseInt(enclosure.Length, 10, 64)
+        }
+    }
+    if episode.Duration > 0 {
+        episode.DurationText = formatClockDuration(episode.Duration)
+    }
+    return episode
+}
+
+// addPodcastEmbedFields puts what the default body template shows into an embed,
+// which ignores the body template.
+func addPodcastEmbedFields(embed *discordgo.MessageEmbed, episode *PodcastEpisode) {
+    embed.Title = episode.Title
+    if episode.Code != "" {
+        embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "Episode", Value: episode.Code, Inline: true})
+    }
+    if episode.Duration > 0 {
+        length := episode.DurationText
+        if episode.Explicit {
+            length += ", explicit"
+        }
+        embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "Length", Value: length, Inline: true})
+    }
+    if episode.AudioURL != "" {
+        embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "Listen", Value: episode.AudioURL})
+    }
+    enforceEmbedLimits(embed)
+}
+
+// podcastImage is the episode's itunes:image, falling back to the show's artwork.
+func podcastImage(feed *gofeed.Feed, item *gofeed.Item) string {
+    if item.ITunesExt != nil && item.ITunesExt.Image != "" {
+        return item.ITunesExt.Image
+    }
+    if item.Image != nil && item.Image.URL != "" {
+        return item.Image.URL
+    }
+    if feed == nil {
+        return ""
+    }
+    if feed.ITunesExt != nil && feed.ITunesExt.Image != "" {
+        return feed.ITunesExt.Image
+    }
+    if feed.Image != nil {
+        return feed.Image.URL
+    }
+    return ""
+}
+
+// formatClockDuration writes d as "1:02:03", or "2:03" under an hour.
+func formatClockDuration(d time.Duration) string {
+    seconds := int(d.Round(time.Second) / time.Second)
+    if seconds >= 3600 {
+        return fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+    }
+    return fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
+}
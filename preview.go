@@ -0,0 +1,196 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/mmcdole/gofeed"
+)
+
+// Preview renders the item for each target exactly as posting it would, without sending anything.
+// The thread doesn't exist yet, so the notify message links to the post channel instead.
+func (fw *FeedWatcher) Preview(feed *gofeed.Feed, item *gofeed.Item, targets []PostTarget) ([]*PostPreview, error) {
+    previews := make([]*PostPreview, 0, len(targets))
+    for _, target := range targets {
+        post, err := fw.renderPost(feed, item, target)
+        if err != nil {
+            return previews, fmt.Errorf("rendering '%s' for guild %s: %w", item.Title, target.GuildID, err)
+        }
+        post.Notify, err = fw.renderNotify(post, "https://discord.com/channels/"+target.GuildID+"/"+target.PostChannelID)
+        if err != nil {
+            return previews, fmt.Errorf("rendering notify message for guild %s: %w", target.GuildID, err)
+        }
+        previews = append(previews, post)
+    }
+    return previews, nil
+}
+
+// PendingItems fetches the feed and lists the items the next run would post, and the ones it would filter out.
+// Nothing is marked or saved, so the cron job still handles them.
+func (fw *FeedWatcher) PendingItems() (feed *gofeed.Feed, items []*gofeed.Item, filtered []*gofeed.Item, err error) {
+    fw.mu.Lock()
+    defer fw.mu.Unlock()
+    feed, err = fw.GetFeed()
+    if err != nil {
+        return nil, nil, nil, err
+    }
+    items, filtered = fw.newItems(feed)
+    return feed, items, filtered, nil
+}
+
+// DryRun fetches every feed and logs what would be posted to each target.
+// It doesn't need a discord connection and never saves any state.
+func (b *Bot) DryRun() error {
+    var errs []error
+    for _, fw := range b.Feeds() {
+        if err := fw.dryRun(); err != nil {
+            log.Printf("[%s] %v", fw.Name(), err)
+            errs = append(errs, err)
+        }
+    }
+    return errors.Join(errs...)
+}
+
+func (fw *FeedWatcher) dryRun() error {
+    saved, err := fw.loadState()
+    if err != nil {
+        return err
+    }
+    feed, items, filtered, err := fw.PendingItems()
+    if err != nil {
+        return fmt.Errorf("getting feed '%s': %w", fw.Name(), err)
+    }
+    if !saved {
+        // Init marks everything in the feed as old news on the first run.
+        log.Printf("[%s] No saved state, the first run posts nothing and marks all %d items as seen.", fw.Name(), len(feed.Items))
+        items, filtered = nil, nil
+    }
+    for _, item := range filtered {
+        log.Printf("[%s] Would skip '%s' (%s), %s.", fw.Name(), item.Title, item.GUID, fw.Filter().Check(feed, item))
+    }
+    if len(fw.Targets()) == 0 {
+        log.Printf("[%s] No guild is subscribed to this feed.", fw.Name())
+    }
+    if len(items) == 0 {
+        if len(feed.Items) == 0 {
+            log.Printf("[%s] No items in feed.", fw.Name())
+            return nil
+        }
+        log.Printf("[%s] Nothing new to post, this is how the latest item would look.", fw.Name())
+        items = feed.Items[:1]
+    } else {
+        log.Printf("[%s] Would post %d new items.", fw.Name(), len(items))
+    }
+    for _, item := range items {
+        previews, err := fw.Preview(feed, item, fw.Targets())
+        for _, post := range previews {
+            log.Printf("[%s] Would post '%s' (%s)\n%s", fw.Name(), item.Title, item.GUID, post.Describe())
+        }
+        if err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// Describe lays the preview out as plain text for the log.
+func (p *PostPreview) Describe() string {
+    var sb strings.Builder
+    fmt.Fprintf(&sb, "  Thread in channel %s of guild %s\n", p.Target.PostChannelID, p.Target.GuildID)
+    fmt.Fprintf(&sb, "  Title: %s\n", p.Title)
+    if p.Embed != nil {
+        fmt.Fprintf(&sb, "  Embed: %s <%s>\n", p.Embed.Title, p.Embed.URL)
+        if p.Embed.Author != nil {
+            fmt.Fprintf(&sb, "  Author: %s\n", p.Embed.Author.Name)
+        }
+        if p.Embed.Thumbnail != nil {
+            fmt.Fprintf(&sb, "  Thumbnail: %s\n", p.Embed.Thumbnail.URL)
+        }
+        fmt.Fprintf(&sb, "%s\n", indent(p.Embed.Description))
+    } else {
+        fmt.Fprintf(&sb, "  Body:\n%s\n", indent(p.Body))
+    }
+    for x, followup := range p.Followups {
+        fmt.Fprintf(&sb, "  Follow up %d:\n%s\n", x+1, indent(followup))
+    }
+    if p.Notify != "" {
+        fmt.Fprintf(&sb, "  Notify in channel %s:\n%s\n", p.Target.NotifyChannelID, indent(p.Notify))
+    }
+    return sb.String()
+}
+
+func indent(s string) string {
+    return "    " + strings.ReplaceAll(strings.TrimRight(s, "\n"), "\n", "\n    ")
+}
+
+func (b *Bot) cmdPreview(i *discordgo.InteractionCreate) error {
+    err := b.deferResponse(i)
+    if err != nil {
+        return err
+    }
+    guild := b.Config().FindGuild(i.GuildID)
+    fw := b.feedFromOptions(i, guild)
+    if guild == nil {
+        return b.editResponse(i, "This server isn't configured.")
+    } else if fw == nil {
+        return b.editResponse(i, "Unknown feed.")
+    }
+    feed, items, filtered, err := fw.PendingItems()
+    if err != nil {
+        return b.editResponse(i, "Can't query feed '"+redactURL(fw.Config().Url)+"'.")
+    }
+    var content string
+    if len(items) > 0 {
+        content = fmt.Sprintf("**Preview** of the next post, %d new items waiting.\n", len(items))
+    } else if len(feed.Items) > 0 {
+        content = "**Preview** of the latest item, nothing new to post.\n"
+        items = feed.Items[:1]
+    } else {
+        return b.editResponse(i, "No items in feed.")
+    }
+    for _, item := range filtered {
+        content += fmt.Sprintf("Skipping '%s', %s.\n", item.Title, fw.Filter().Check(feed, item))
+    }
+    target, _ := guild.TargetFor(fw.Config())
+    previews, err := fw.Preview(feed, items[0], []PostTarget{target})
+    if err != nil {
+        return b.editResponse(i, fmt.Sprintf("Can't render '%s': %v", items[0].Title, err))
+    }
+    post := previews[0]
+    content += fmt.Sprintf("Thread `%s` in <#%s>", post.Title, target.PostChannelID)
+    if len(post.Followups) > 0 {
+        content += fmt.Sprintf(" with %d follow ups", len(post.Followups))
+    }
+    if target.NotifyChannelID != "" {
+        content += fmt.Sprintf(", notify in <#%s>", target.NotifyChannelID)
+    }
+    content += ".\n*Nothing was posted.*"
+    err = b.editResponse(i, content)
+    if err != nil {
+        return err
+    }
+
+    // The rest are sent as they would be, one message each, but with mentions turned off.
+    messages := []*discordgo.WebhookParams{{Content: post.Body}}
+    if post.Embed != nil {
+        messages[0] = &discordgo.WebhookParams{Embeds: []*discordgo.MessageEmbed{post.Embed}}
+    }
+    for _, followup := range post.Followups {
+        messages = append(messages, &discordgo.WebhookParams{Content: followup})
+    }
+    if post.Notify != "" {
+        messages = append(messages, &discordgo.WebhookParams{Content: post.Notify})
+    }
+    for _, msg := range messages {
+        msg.Flags = responseFlags(i)
+        msg.AllowedMentions = &discordgo.MessageAllowedMentions{}
+        _, err = b.discord.FollowupMessageCreate(i.Interaction, true, msg)
+        if err != nil {
+            return err
+        }
+    }
+    return nil
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"time"
+)
+
+const configWatchInterval = 5 * time.Second
+
+// watchFile polls path and signals on the returned channel when its size or
+// modification time changes. Polling keeps working when editors replace the file.
+func watchFile(path string, interval time.Duration, stop <-chan struct{}) <-chan struct{} {
+    changed := make(chan struct{}, 1)
+    last, _ := os.Stat(path)
+    go func() {
+        ticker := time.NewTicker(interval)
+        defer ticker.Stop()
+        for {
+            select {
+            case <-stop:
+                return
+            case <-ticker.C:
+            }
+            info, err := os.Stat(path)
+            if err != nil {
+                // Most likely halfway through being replaced, try again next tick.
+                continue
+            }
+            if last != nil && info.ModTime().Equal(last.ModTime()) && info.Size() == last.Size() {
+                continue
+            }
+            last = info
+            select {
+            case changed <- struct{}{}:
+            default:
+            }
+        }
+    }()
+    return changed
+}
+
+func (b *Bot) reloadOrKeep(path string) {
+    cfg, err := LoadConfig(path)
+    if err == nil {
+        err = b.Reload(cfg)
+    }
+    if err != nil {
+        logLvlLn(LogProd, "Error reloading config, keeping the old one.", err)
+    }
+}
+
+// Reload applies a new config to the running bot. Every feed is checked and any
+// new feed is initialized before anything changes, so an error leaves the old config running.
+func (b *Bot) Reload(cfg *Config) error {
+    if err := cfg.Validate(); err != nil {
+        return err
+    }
+    old := b.Config()
+    running := b.Feeds()
+    byName := make(map[string]*FeedWatcher, len(running))
+    for _, fw := range running {
+        byName[fw.Name()] = fw
+    }
+
+    setups := make([]*feedSetup, len(cfg.Feeds))
+    for x := range cfg.Feeds {
+        feed := &cfg.Feeds[x]
+        setup, err := newFeedSetup(feed, cfg.TargetsFor(feed))
+        if err != nil {
+            return fmt.Errorf("setting up feed '%s': %w", feed.Name, err)
+        }
+        setups[x] = setup
+    }
+
+    // A feed is kept when its name and url match, otherwise it starts over as a new one.
+    feeds := make([]*FeedWatcher, len(setups))
+    added := make(map[*FeedWatcher]bool)
+    for x, setup := range setups {
+        if fw, ok := byName[setup.cfg.Name]; ok && fw.Config().Url == setup.cfg.Url {
+            feeds[x] = fw
+            continue
+        }
+        fw, err := NewFeedWatcher(b, setup.cfg, setup.targets)
+        if err != nil {
+            return err
+        }
+        if err := fw.Init(); err != nil {
+            return err
+        }
+        feeds[x] = fw
+        added[fw] = true
+    }
+
+    for _, setting := range restartOnlyChanges(old, cfg) {
+        logLvlF(LogProd, "%s changed, restart the bot to apply it.", setting)
+    }
+    kept := make(map[*FeedWatcher]bool, len(feeds))
+    for x, fw := range feeds {
+        kept[fw] = true
+        rescheduled := added[fw] || fw.Config().CronSchedule != setups[x].cfg.CronSchedule
+        if !added[fw] {
+            fw.replaceSetup(setups[x])
+        }
+        if rescheduled {
+            if err := b.scheduleFeed(fw); err != nil {
+                logLvlLn(LogProd, "Error rescheduling feed.", err)
+            } else {
+                logLvlLn(LogProd, "Scheduled feed", fw.Name(), fw.Config().CronSchedule)
+            }
+        }
+    }
+    for _, fw := range running {
+        if kept[fw] {
+            continue
+        }
+        if err := b.schdl.RemoveJob(fw.job.ID()); err != nil {
+            logLvlLn(LogProd, "Error removing feed job.", fw.Name(), err)
+        }
+        logLvlLn(LogProd, "Stopped feed", fw.Name())
+    }
+    b.config.Store(cfg)
+    b.mu.Lock()
+    b.feeds = feeds
+    b.mu.Unlock()
+
+    if b.session != nil {
+        if cfg.DiscordBot.Status != old.DiscordBot.Status {
+            if err := b.session.UpdateGameStatus(0, cfg.DiscordBot.Status); err != nil {
+                logLvlLn(LogProd, "Error updating status.", err)
+            }
+        }
+        if commandsChanged(old, cfg) {
+            if err := b.reregisterCommands(); err != nil {
+                logLvlLn(LogProd, "Error registering commands.", err)
+            }
+        }
+    }
+    logLvlF(LogProd, "Reloaded config, %d feeds running.", len(feeds))
+    return nil
+}
+
+// reregisterCommands registers the commands for the current config and
+// removes them from guilds the bot no longer serves.
+func (b *Bot) reregisterCommands() error {
+    registered, err := b.UpDiscord()
+    for guildID, cmds := range b.registered {
+        if _, ok := registered[guildID]; ok {
+            continue
+        }
+        if err := b.deleteCommands(guildID, cmds); err != nil {
+            logLvlLn(LogProd, "Error removing commands.", err)
+        }
+    }
+    b.registered = registered
+    return err
+}
+
+// restartOnlyChanges lists the settings that are only read at startup.
+func restartOnlyChanges(old *Config, cfg *Config) []string {
+    changes := []string{}
+    if old.DiscordBot.Token != cfg.DiscordBot.Token {
+        changes = append(changes, "DiscordBot.Token")
+    }
+    if old.DiscordBot.Logging != cfg.DiscordBot.Logging {
+        changes = append(changes, "DiscordBot.Logging")
+    }
+    if old.State != cfg.State {
+        changes = append(changes, "[State]")
+    }
+    if old.Fetch != cfg.Fetch {
+        changes = append(changes, "[Fetch]")
+    }
+    if old.StatusServer != cfg.StatusServer {
+        changes = append(changes, "[StatusServer]")
+    }
+    return changes
+}
+
+// commandsChanged reports whether the registered commands would come out different,
+// so saving an unrelated setting doesn't use up discord's daily command creation limit.
+func commandsChanged(old *Config, cfg *Config) bool {
+    return old.GlobalCommands != cfg.GlobalCommands ||
+        !reflect.DeepEqual(old.Permissions, cfg.Permissions) ||
+        !reflect.DeepEqual(commandScopes(old), commandScopes(cfg))
+}
+
+// commandScopes maps each guild commands are registered in to the feed choices it gets.
+func commandScopes(c *Config) map[string][]string {
+    scopes := make(map[string][]string)
+    if c.GlobalCommands {
+        for _, feed := range c.Feeds {
+            scopes[""] = append(scopes[""], feed.Name)
+        }
+        return scopes
+    }
+    for _, guild := range c.Guilds {
+        names := []string{}
+        for _, feed := range c.Feeds {
+            if guild.HasFeed(feed.Name) {
+                names = append(names, feed.Name)
+            }
+        }
+        scopes[guild.GuildID] = names
+    }
+    return scopes
+}
+
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/andybalholm/cascadia"
+	"github.com/mmcdole/gofeed"
+)
+
+// scrapeDateLayouts are tried in order when Scrape.DateLayout isn't set.
+var scrapeDateLayouts = []string{
+    time.RFC3339,
+    time.RFC1123Z,
+    time.RFC1123,
+    "2006-01-02T15:04:05",
+    "2006-01-02 15:04",
+    "2006-01-02",
+    "January 2, 2006",
+    "Jan 2, 2006",
+    "2 January 2006",
+    "02/01/2006",
+}
+
+// scrapeSelector is a CSS selector, optionally reading an attribute instead of the text.
+type scrapeSelector struct {
+    css string
+    attr string
+}
+
+// parseScrapeSelector reads "css", "css@attr" or "@attr", the last one being the item element itself.
+func parseScrapeSelector(name string, sel string) (scrapeSelector, error) {
+    css, attr, _ := strings.Cut(strings.TrimSpace(sel), "@")
+    s := scrapeSelector{css: strings.TrimSpace(css), attr: strings.TrimSpace(attr)}
+    if s.css != "" {
+        if _, err := cascadia.Compile(s.css); err != nil {
+            return s, fmt.Errorf("%s: '%s' isn't a css selector: %w", name, s.css, err)
+        }
+    }
+    return s, nil
+}
+
+// scrapeSource reads items out of an HTML page with the CSS selectors in [Feed.Scrape],
+// for sites without a feed.
+type scrapeSource struct {
+    base *url.URL
+    item string
+    title scrapeSelector
+    link scrapeSelector
+    description scrapeSelector
+    date scrapeSelector
+    dateLayout string
+    image scrapeSelector
+    guid scrapeSelector
+}
+
+func newScrapeSource(pageURL string, cfg ScrapeConfig) (*scrapeSource, error) {
+    if cfg.Item == "" {
+        return nil, errors.New("Item is required, the css selector for each item on the page")
+    }
+    if cfg.Title == "" {
+        return nil, errors.New("Title is required")
+    }
+    base, err := url.Parse(pageURL)
+    if err != nil {
+        return nil, err
+    }
+    s := &scrapeSource{base: base, dateLayout: cfg.DateLayout}
+    if _, err := cascadia.Compile(cfg.Item); err != nil {
+        return nil, fmt.Errorf("Item: '%s' isn't a css selector: %w", cfg.Item, err)
+    }
+    s.item = cfg.Item
+    if cfg.Link == "" {
+        cfg.Link = "a@href"
+    }
+    if cfg.Image == "" {
+        cfg.Image = "img@src"
+    }
+    selectors := []struct {
+        name string
+        sel string
+        dst *scrapeSelector
+    }{
+        {"Title", cfg.Title, &s.title},
+        {"Link", cfg.Link, &s.link},
+        {"Description", cfg.Description, &s.description},
+        {"Date", cfg.Date, &s.date},
+        {"Image", cfg.Image, &s.image},
+        {"GUID", cfg.GUID, &s.guid},
+    }
+    for _, sel := range selectors {
+        if sel.sel == "" {
+            continue
+        }
+        if *sel.dst, err = parseScrapeSelector(sel.name, sel.sel); err != nil {
+            return nil, err
+        }
+    }
+    return s, nil
+}
+
+// Parse builds a feed from every element matching the item selector.
+// Items without a title and link are skipped and the guid falls back to the link.
+// Items without a date are dated when they are scraped, like any feed's.
+func (s *scrapeSource) Parse(body []byte) (*gofeed.Feed, error) {
+    doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+    if err != nil {
+        return nil, fmt.Errorf("parsing page: %w", err)
+    }
+    feed := &gofeed.Feed{
+        Title: strings.TrimSpace(doc.Find("title").First().Text()),
+        Link: s.base.String(),
+        FeedType: FeedTypeScrape,
+    }
+    doc.Find(s.item).Each(func(_ int, el *goquery.Selection) {
+        item := &gofeed.Item{
+            Title: s.title.text(el),
+            Link: s.resolve(s.link.text(el)),
+            GUID: s.guid.text(el),
+        }
+        if item.Title == "" && item.Link == "" {
+            return
+        }
+        if item.Link != "" {
+            item.Links = []string{item.Link}
+        }
+        if item.GUID == "" {
+            item.GUID = item.Link
+        }
+        if item.GUID == "" {
+            item.GUID = item.Title
+        }
+        item.Description = s.description.html(el)
+        if image := s.resolve(s.image.text(el)); image != "" {
+            item.Image = &gofeed.Image{URL: image}
+        }
+        item.Published = s.date.text(el)
+        if published, ok := s.parseDate(item.Published); ok {
+            item.PublishedParsed = &published
+        }
+        feed.Items = append(feed.Items, item)
+    })
+    if len(feed.Items) == 0 {
+        return nil, fmt.Errorf("no items match the selector '%s'", s.item)
+    }
+    return feed, nil
+}
+
+func (s *scrapeSource) Extend(data *TemplateData) {}
+
+// resolve makes links relative to the page absolute.
+func (s *scrapeSource) resolve(link string) string {
+    if link == "" {
+        return ""
+    }
+    u, err := s.base.Parse(link)
+    if err != nil {
+        return link
+    }
+    return u.String()
+}
+
+func (s *scrapeSource) parseDate(value string) (time.Time, bool) {
+    if value == "" {
+        return time.Time{}, false
+    }
+    layouts := scrapeDateLayouts
+    if s.dateLayout != "" {
+        layouts = []string{s.dateLayout}
+    }
+    for _, layout := range layouts {
+        if t, err := time.Parse(layout, value); err == nil {
+            return t, true
+        }
+    }
+    return time.Time{}, false
+}
+
+// find is the element the selector points at inside the item, the item itself without css.
+func (sel scrapeSelector) find(el *goquery.Selection) *goquery.Selection {
+    if sel.css == "" {
+        return el
+    }
+    return el.Find(sel.css).First()
+}
+
+// text reads the attribute, or the text when there is none. An unset selector reads "".
+func (sel scrapeSelector) text(el *goquery.Selection) string {
+    if sel.css == "" && sel.attr == "" {
+        return ""
+    }
+    found := sel.find(el)
+    if sel.attr != "" {
+        val, _ := found.Attr(sel.attr)
+        return strings.TrimSpace(val)
+    }
+    return strings.TrimSpace(found.Text())
+}
+
+// html reads the element's inner HTML, so the Description mode can clean it up like a feed's.
+func (sel scrapeSelector) html(el *goquery.Selection) string {
+    if sel.css == "" && sel.attr == "" {
+        return ""
+    }
+    if sel.attr != "" {
+        return sel.text(el)
+    }
+    html, err := sel.find(el).Html()
+    if err != nil {
+        return ""
+    }
+    return strings.TrimSpace(html)
+}
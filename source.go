@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/mmcdole/gofeed/atom"
+	ext "github.com/mmcdole/gofeed/extensions"
+	"github.com/mmcdole/gofeed/json"
+	"github.com/mmcdole/gofeed/rss"
+)
+
+const FeedTypeRSS = "rss"
+const FeedTypeAtom = "atom"
+const FeedTypeJSON = "json"
+const FeedTypeYouTube = "youtube"
+const FeedTypePodcast = "podcast"
+const FeedTypeScrape = "scrape"
+
+// feedTypes are the values Feed.Type can take, "" detects rss, atom or json from the body.
+var feedTypes = []string{"", FeedTypeRSS, FeedTypeAtom, FeedTypeJSON, FeedTypeYouTube, FeedTypePodcast, FeedTypeScrape}
+
+// FeedSource turns a fetched body into the gofeed model the rest of the bot works with,
+// so filters, embeds and templates don't need to know what kind of feed it came from.
+// Fetching is shared, every source gets the conditional requests, retries and size cap.
+type FeedSource interface {
+    Parse(body []byte) (*gofeed.Feed, error)
+    // Extend adds the source's own fields to the template data.
+    Extend(data *TemplateData)
+}
+
+// newFeedSource picks the source for a feed's Type, ignoring case.
+func newFeedSource(cfg *FeedConfig) (FeedSource, error) {
+    switch strings.ToLower(cfg.Type) {
+    case "":
+        return detectSource{}, nil
+    case FeedTypeRSS, FeedTypeAtom, FeedTypeJSON:
+        return formatSource{feed: cfg.Name, format: strings.ToLower(cfg.Type)}, nil
+    case FeedTypeYouTube:
+        return youTubeSource{}, nil
+    case FeedTypePodcast:
+        return podcastSource{}, nil
+    case FeedTypeScrape:
+        return newScrapeSource(cfg.Url, cfg.Scrape)
+    }
+    return nil, fmt.Errorf("must be one of %s, got '%s'", strings.Join(feedTypes[1:], ", "), cfg.Type)
+}
+
+// detectSource lets gofeed work out whether the body is rss, atom or json.
+type detectSource struct{}
+
+func (detectSource) Parse(body []byte) (*gofeed.Feed, error) {
+    return ParseFeed(string(body))
+}
+
+func (detectSource) Extend(data *TemplateData) {}
+
+// formatSource parses the body as one format, for feeds gofeed detects wrong.
+type formatSource struct {
+    feed string
+    format string
+}
+
+// Parse falls back to detection when the body is clearly another format.
+// Type used to be free text, and old configs pair Type="RSS" with YouTube's Atom feed.
+func (s formatSource) Parse(body []byte) (*gofeed.Feed, error) {
+    feed, err := parseFeedAs(s.format, body)
+    if err == nil {
+        return feed, nil
+    }
+    detected := detectedFormat(body)
+    if detected == "" || detected == s.format {
+        return nil, err
+    }
+    logLvlF(LogProd, "Feed '%s' has Type \"%s\" but looks like %s, parsing it as %s. Set Type to \"%s\" or leave it empty.", s.feed, s.format, detected, detected, detected)
+    return parseFeedAs(detected, body)
+}
+
+func (formatSource) Extend(data *TemplateData) {}
+
+// parseFeedAs parses body with the parser for format, skipping detection.
+func parseFeedAs(format string, body []byte) (feed *gofeed.Feed, err error) {
+    switch format {
+    case FeedTypeRSS:
+        var parsed *rss.Feed
+        if parsed, err = (&rss.Parser{}).Parse(bytes.NewReader(body)); err == nil {
+            feed, err = (&gofeed.DefaultRSSTranslator{}).Translate(parsed)
+        }
+    case FeedTypeAtom:
+        var parsed *atom.Feed
+        if parsed, err = (&atom.Parser{}).Parse(bytes.NewReader(body)); err == nil {
+            feed, err = (&gofeed.DefaultAtomTranslator{}).Translate(parsed)
+        }
+    case FeedTypeJSON:
+        var parsed *json.Feed
+        if parsed, err = (&json.Parser{}).Parse(bytes.NewReader(body)); err == nil {
+            feed, err = (&gofeed.DefaultJSONTranslator{}).Translate(parsed)
+        }
+    default:
+        return nil, fmt.Errorf("unknown feed format '%s'", format)
+    }
+    if err != nil {
+        if detected := detectedFormat(body); detected != "" && detected != format {
+            return nil, fmt.Errorf("parsing %s feed: %w (it looks like %s, set Type to \"%s\" or leave it empty)", format, err, detected, detected)
+        }
+        return nil, fmt.Errorf("parsing %s feed: %w", format, err)
+    }
+    return feed, nil
+}
+
+func detectedFormat(body []byte) string {
+    switch gofeed.DetectFeedType(bytes.NewReader(body)) {
+    case gofeed.FeedTypeRSS:
+        return FeedTypeRSS
+    case gofeed.FeedTypeAtom:
+        return FeedTypeAtom
+    case gofeed.FeedTypeJSON:
+        return FeedTypeJSON
+    }
+    return ""
+}
+
+// fillPublished dates items without a published date by their updated date,
+// or now when they have neither, so every source's items can be ordered and posted.
+func fillPublished(feed *gofeed.Feed, now time.Time) {
+    for _, item := range feed.Items {
+        if item.PublishedParsed != nil {
+            continue
+        }
+        if item.UpdatedParsed != nil {
+            published := *item.UpdatedParsed
+            item.PublishedParsed = &published
+        } else {
+            published := now
+            item.PublishedParsed = &published
+        }
+    }
+}
+
+// extension finds the first element name in the item's namespace, looking inside group elements too.
+func extension(item *gofeed.Item, namespace string, name string) *ext.Extension {
+    elements, ok := item.Extensions[namespace]
+    if !ok {
+        return nil
+    }
+    if found := elements[name]; len(found) > 0 {
+        return &found[0]
+    }
+    for _, group := range elements["group"] {
+        if found := group.Children[name]; len(found) > 0 {
+            return &found[0]
+        }
+    }
+    return nil
+}
+
+// extensionValue is the text of the first element name, or "".
+func extensionValue(item *gofeed.Item, namespace string, name string) string {
+    if e := extension(item, namespace, name); e != nil {
+        return strings.TrimSpace(e.Value)
+    }
+    return ""
+}
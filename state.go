@@ -0,0 +1,294 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const StateJSON = "json"
+const StateBolt = "bolt"
+
+// FeedState is everything the bot needs to remember about a feed between restarts.
+// Url is the feed's url when it was saved, state for another url belongs to a different feed.
+type FeedState struct {
+    Url           string                  `json:"url"`
+    LastPublished time.Time               `json:"lastPublished"`
+    Visited       map[string]uint8        `json:"visited"`
+    Posts         map[string][]PostRecord `json:"posts"`
+}
+
+// PostRecord holds the discord ids created when an item was posted.
+type PostRecord struct {
+    GuildID         string    `json:"guildId"`
+    ThreadID        string    `json:"threadId"`
+    ParentID        string    `json:"parentId"`
+    NotifyChannelID string    `json:"notifyChannelId,omitempty"`
+    NotifyMessageID string    `json:"notifyMessageId,omitempty"`
+    FollowupIDs     []string  `json:"followupIds,omitempty"`
+    PostedAt        time.Time `json:"postedAt"`
+}
+
+// StateStore persists FeedState keyed by feed.
+// LoadFeed returns nil without an error when nothing was saved for the key yet.
+type StateStore interface {
+    LoadFeed(key string) (*FeedState, error)
+    SaveFeed(key string, state *FeedState) error
+    Close() error
+}
+
+// WatcherState is the in memory FeedState of a running feed.
+// Commands and the metrics server read it while the posting pipeline writes to it,
+// so every access goes through its lock.
+type WatcherState struct {
+    mu            sync.RWMutex
+    lastPublished time.Time
+    visited       map[string]uint8
+    posts         map[string][]PostRecord
+}
+
+func NewWatcherState() *WatcherState {
+    return &WatcherState{
+        visited: make(map[string]uint8),
+        posts:   make(map[string][]PostRecord),
+    }
+}
+
+// Load replaces the state with a saved one.
+func (s *WatcherState) Load(saved *FeedState) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.lastPublished = saved.LastPublished
+    s.visited = make(map[string]uint8, len(saved.Visited))
+    for guid, val := range saved.Visited {
+        s.visited[guid] = val
+    }
+    s.posts = make(map[string][]PostRecord, len(saved.Posts))
+    for guid, records := range saved.Posts {
+        s.posts[guid] = append([]PostRecord(nil), records...)
+    }
+}
+
+// Snapshot copies the state so it can be saved without holding the lock.
+func (s *WatcherState) Snapshot() *FeedState {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+    snap := &FeedState{
+        LastPublished: s.lastPublished,
+        Visited:       make(map[string]uint8, len(s.visited)),
+        Posts:         make(map[string][]PostRecord, len(s.posts)),
+    }
+    for guid, val := range s.visited {
+        snap.Visited[guid] = val
+    }
+    for guid, records := range s.posts {
+        snap.Posts[guid] = append([]PostRecord(nil), records...)
+    }
+    return snap
+}
+
+func (s *WatcherState) LastPublished() time.Time {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+    return s.lastPublished
+}
+
+func (s *WatcherState) Visited(guid string) (uint8, bool) {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+    val, found := s.visited[guid]
+    return val, found
+}
+
+// IsNew reports whether the item still needs posting.
+func (s *WatcherState) IsNew(guid string) bool {
+    val, found := s.Visited(guid)
+    return !found || val == VisitedSeen
+}
+
+// MarkFiltered records that the item was filtered out, so it isn't checked again.
+func (s *WatcherState) MarkFiltered(guid string) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.visited[guid] = VisitedFiltered
+}
+
+// Update marks guids we haven't met before with visitType and forgets
+// everything that has dropped out of the feed.
+func (s *WatcherState) Update(guids []string, visitType uint8) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    current := make(map[string]bool, len(guids))
+    for _, guid := range guids {
+        current[guid] = true
+        if _, found := s.visited[guid]; !found {
+            s.visited[guid] = visitType
+        }
+    }
+    for guid := range s.visited {
+        if !current[guid] {
+            delete(s.visited, guid)
+            delete(s.posts, guid)
+        }
+    }
+}
+
+// MarkPosted records a thread created for the item.
+// lastPublished only moves forward, posting an older item doesn't rewind it.
+func (s *WatcherState) MarkPosted(guid string, published time.Time, record PostRecord) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    if published.After(s.lastPublished) {
+        s.lastPublished = published
+    }
+    s.visited[guid] = VisitedPosted
+    s.posts[guid] = append(s.posts[guid], record)
+}
+
+// UpdatePost replaces the record for the same thread, once its follow ups or notification are sent.
+func (s *WatcherState) UpdatePost(guid string, record PostRecord) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    for x := range s.posts[guid] {
+        if s.posts[guid][x].ThreadID == record.ThreadID {
+            s.posts[guid][x] = record
+        }
+    }
+}
+
+func NewStateStore(storeType string, path string) (StateStore, error) {
+    switch storeType {
+    case "", StateJSON:
+        if path == "" {
+            path = "state.json"
+        }
+        return NewJSONStateStore(path)
+    case StateBolt:
+        if path == "" {
+            path = "state.db"
+        }
+        return NewBoltStateStore(path)
+    default:
+        return nil, fmt.Errorf("unknown state store type '%s'", storeType)
+    }
+}
+
+type JSONStateStore struct {
+    path  string
+    mu    sync.Mutex
+    feeds map[string]*FeedState
+}
+
+func NewJSONStateStore(path string) (*JSONStateStore, error) {
+    s := &JSONStateStore{
+        path:  path,
+        feeds: make(map[string]*FeedState),
+    }
+    file, err := os.ReadFile(path)
+    if os.IsNotExist(err) {
+        return s, nil
+    }
+    if err != nil {
+        return nil, err
+    }
+    if len(file) == 0 {
+        return s, nil
+    }
+    err = json.Unmarshal(file, &s.feeds)
+    if err != nil {
+        return nil, fmt.Errorf("reading state file '%s': %w", path, err)
+    }
+    return s, nil
+}
+
+func (s *JSONStateStore) LoadFeed(key string) (*FeedState, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    return s.feeds[key], nil
+}
+
+func (s *JSONStateStore) SaveFeed(key string, state *FeedState) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.feeds[key] = state
+    file, err := json.MarshalIndent(s.feeds, "", "  ")
+    if err != nil {
+        return err
+    }
+    // Write to a temp file and rename so a crash never leaves half a state file.
+    tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+    if err != nil {
+        return err
+    }
+    _, err = tmp.Write(file)
+    if err == nil {
+        err = tmp.Sync()
+    }
+    closeErr := tmp.Close()
+    if err == nil {
+        err = closeErr
+    }
+    if err != nil {
+        os.Remove(tmp.Name())
+        return err
+    }
+    return os.Rename(tmp.Name(), s.path)
+}
+
+func (s *JSONStateStore) Close() error {
+    return nil
+}
+
+var boltFeedsBucket = []byte("feeds")
+
+type BoltStateStore struct {
+    db *bolt.DB
+}
+
+func NewBoltStateStore(path string) (*BoltStateStore, error) {
+    db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+    if err != nil {
+        return nil, fmt.Errorf("opening state db '%s': %w", path, err)
+    }
+    err = db.Update(func(tx *bolt.Tx) error {
+        _, err := tx.CreateBucketIfNotExists(boltFeedsBucket)
+        return err
+    })
+    if err != nil {
+        db.Close()
+        return nil, err
+    }
+    return &BoltStateStore{db: db}, nil
+}
+
+func (s *BoltStateStore) LoadFeed(key string) (*FeedState, error) {
+    var state *FeedState
+    err := s.db.View(func(tx *bolt.Tx) error {
+        val := tx.Bucket(boltFeedsBucket).Get([]byte(key))
+        if val == nil {
+            return nil
+        }
+        state = &FeedState{}
+        return json.Unmarshal(val, state)
+    })
+    return state, err
+}
+
+func (s *BoltStateStore) SaveFeed(key string, state *FeedState) error {
+    val, err := json.Marshal(state)
+    if err != nil {
+        return err
+    }
+    return s.db.Update(func(tx *bolt.Tx) error {
+        return tx.Bucket(boltFeedsBucket).Put([]byte(key), val)
+    })
+}
+
+func (s *BoltStateStore) Close() error {
+    return s.db.Close()
+}
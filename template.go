@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	"golang.org/x/net/html"
+)
+
+const DefaultTitleTemplate = `{{date .TimeFormat .Item.PublishedParsed}} - {{.Item.Title}}`
+const DefaultBodyTemplate = `{{range .Item.Links}}{{.}}
+{{end}}{{.Description}}
+`
+const DefaultNotifyTemplate = `{{.NotifyPrefix}} {{.Link}}
+{{.Item.Title}}`
+
+// TemplateData is what the message templates are executed against.
+type TemplateData struct {
+    Feed *gofeed.Feed
+    Item *gofeed.Item
+    // Description is Item.Description cleaned up by the feed's Description mode.
+    Description string
+    FeedName string
+    TimeFormat string
+    NotifyPrefix string
+    GuildID string
+    // Link to the forum thread, only set for the notify template.
+    Link string
+    // YouTube is only set for feeds with Type "youtube".
+    YouTube *YouTubeVideo
+    // Podcast is only set for feeds with Type "podcast".
+    Podcast *PodcastEpisode
+}
+
+type MsgTemplates struct {
+    Title *template.Template
+    Body *template.Template
+    Notify *template.Template
+}
+
+var templateFuncs = template.FuncMap{
+    "truncate": func(maxLen int, s string) string {
+        return truncateString(s, maxLen)
+    },
+    "date": func(layout string, t *time.Time) string {
+        if t == nil {
+            return ""
+        }
+        return t.Format(layout)
+    },
+    "stripHTML": stripHTML,
+    "markdown": HTMLToMarkdown,
+    "thumbnail": itemThumbnail,
+    "join": func(sep string, s []string) string {
+        return strings.Join(s, sep)
+    },
+    "trim": strings.TrimSpace,
+}
+
+// defaultMsgTemplates fills in the templates left blank with the defaults for the kind of feed.
+func defaultMsgTemplates(msg *MsgConfig, feedType string) {
+    title, body := DefaultTitleTemplate, DefaultBodyTemplate
+    if strings.ToLower(feedType) == FeedTypePodcast {
+        title, body = DefaultPodcastTitleTemplate, DefaultPodcastBodyTemplate
+    }
+    if msg.TitleTemplate == "" {
+        msg.TitleTemplate = title
+    }
+    if msg.BodyTemplate == "" {
+        msg.BodyTemplate = body
+    }
+    if msg.NotifyTemplate == "" {
+        msg.NotifyTemplate = DefaultNotifyTemplate
+    }
+}
+
+func ParseMsgTemplates(msg MsgConfig) (*MsgTemplates, error) {
+    var err error
+    t := &MsgTemplates{}
+    t.Title, err = template.New("title").Funcs(templateFuncs).Parse(msg.TitleTemplate)
+    if err != nil {
+        return nil, err
+    }
+    t.Body, err = template.New("body").Funcs(templateFuncs).Parse(msg.BodyTemplate)
+    if err != nil {
+        return nil, err
+    }
+    t.Notify, err = template.New("notify").Funcs(templateFuncs).Parse(msg.NotifyTemplate)
+    if err != nil {
+        return nil, err
+    }
+    return t, nil
+}
+
+func RenderTemplate(tmpl *template.Template, data *TemplateData) (string, error) {
+    var sb strings.Builder
+    err := tmpl.Execute(&sb, data)
+    if err != nil {
+        return "", fmt.Errorf("rendering %s template: %w", tmpl.Name(), err)
+    }
+    return sb.String(), nil
+}
+
+// stripHTML drops every tag and decodes entities, leaving only the text.
+func stripHTML(s string) string {
+    var sb strings.Builder
+    z := html.NewTokenizer(strings.NewReader(s))
+    for {
+        switch z.Next() {
+        case html.ErrorToken:
+            return sb.String()
+        case html.TextToken:
+            sb.Write(z.Text())
+        }
+    }
+}
+
+// itemThumbnail finds the best image url for an item,
+// checking media:thumbnail (and YouTube's media:group) before item.Image.
+func itemThumbnail(item *gofeed.Item) string {
+    if media, ok := item.Extensions["media"]; ok {
+        for _, group := range media["group"] {
+            for _, thumb := range group.Children["thumbnail"] {
+                if url := thumb.Attrs["url"]; url != "" {
+                    return url
+                }
+            }
+        }
+        for _, thumb := range media["thumbnail"] {
+            if url := thumb.Attrs["url"]; url != "" {
+                return url
+            }
+        }
+    }
+    if item.Image != nil {
+        return item.Image.URL
+    }
+    return ""
+}
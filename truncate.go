@@ -0,0 +1,222 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/rivo/uniseg"
+)
+
+const truncateSuffix = "..."
+
+var markdownLinkPattern = regexp.MustCompile(`^\[[^\]]*\]\([^)\s]*\)`)
+
+// textLength counts characters the way discord does for its length limits, by code point.
+func textLength(s string) int {
+    return utf8.RuneCountInString(s)
+}
+
+// truncateString shortens body to at most maxLen characters including the "..." suffix.
+// It never splits a grapheme, prefers to cut on a word boundary and
+// drops or closes any markdown left unterminated by the cut.
+func truncateString(body string, maxLen int) string {
+    if textLength(body) <= maxLen {
+        return body
+    }
+    suffix := truncateSuffix
+    if maxLen <= textLength(suffix) {
+        suffix = ""
+    }
+    budget := maxLen - textLength(suffix)
+    for budget > 0 {
+        cut, rest := cutGraphemes(body, budget)
+        cut = trimToWord(cut, rest)
+        cut = closeMarkdown(strings.TrimRightFunc(cut, unicode.IsSpace))
+        result := cut + suffix
+        if textLength(result) <= maxLen {
+            return result
+        }
+        budget -= textLength(result) - maxLen
+    }
+    return ""
+}
+
+// cutGraphemes splits s after as many whole graphemes as fit in maxLen characters.
+func cutGraphemes(s string, maxLen int) (string, string) {
+    length := 0
+    pos := 0
+    state := -1
+    rest := s
+    for len(rest) > 0 {
+        var cluster string
+        cluster, rest, _, state = uniseg.FirstGraphemeClusterInString(rest, state)
+        n := textLength(cluster)
+        if length+n > maxLen {
+            break
+        }
+        length += n
+        pos += len(cluster)
+    }
+    return s[:pos], s[pos:]
+}
+
+// trimToWord backs the cut up to the last space, unless that would throw away
+// more than a third of it.
+func trimToWord(cut string, rest string) string {
+    if rest == "" || cut == "" {
+        return cut
+    }
+    next, _ := utf8.DecodeRuneInString(rest)
+    last, _ := utf8.DecodeLastRuneInString(cut)
+    if unicode.IsSpace(next) || unicode.IsSpace(last) {
+        return cut
+    }
+    idx := strings.LastIndexFunc(cut, unicode.IsSpace)
+    if idx < len(cut)*2/3 {
+        return cut
+    }
+    return cut[:idx]
+}
+
+// closeMarkdown drops unterminated code blocks, inline code and links,
+// and closes any emphasis left open.
+func closeMarkdown(s string) string {
+    if strings.Count(s, "```")%2 == 1 {
+        s = strings.TrimRightFunc(s[:strings.LastIndex(s, "```")], unicode.IsSpace)
+    }
+    // Only the text after the last code block can still have open inline markdown.
+    start := 0
+    if idx := strings.LastIndex(s, "```"); idx >= 0 {
+        start = idx + len("```")
+    }
+    tail := s[start:]
+    if strings.Count(tail, "`")%2 == 1 {
+        tail = tail[:strings.LastIndex(tail, "`")]
+    }
+    if idx := strings.LastIndex(tail, "["); idx >= 0 && !markdownLinkPattern.MatchString(tail[idx:]) {
+        link := tail[idx:]
+        closeIdx := strings.Index(link, "]")
+        if closeIdx < 0 || strings.HasPrefix(link[closeIdx:], "](") {
+            tail = tail[:idx]
+        }
+    }
+    tail = strings.TrimRightFunc(tail, unicode.IsSpace)
+
+    type opener struct {
+        pos int
+        marker string
+    }
+    open := []opener{}
+    stripped := tail
+    for _, marker := range []string{"**", "__", "~~", "||"} {
+        if strings.Count(stripped, marker)%2 == 1 {
+            open = append(open, opener{strings.LastIndex(stripped, marker), marker})
+        }
+        stripped = strings.ReplaceAll(stripped, marker, "  ")
+    }
+    stripped = blankLoneAsterisks(stripped)
+    if strings.Count(stripped, "*")%2 == 1 {
+        open = append(open, opener{strings.LastIndex(stripped, "*"), "*"})
+    }
+    sort.Slice(open, func(a, b int) bool {
+        return open[a].pos > open[b].pos
+    })
+    closers := ""
+    for _, o := range open {
+        if strings.TrimSpace(tail[o.pos+len(o.marker):]) == "" {
+            // Nothing left inside it, so drop the marker instead of closing it.
+            tail = strings.TrimRightFunc(tail[:o.pos], unicode.IsSpace)
+        } else {
+            closers += o.marker
+        }
+    }
+    return s[:start] + tail + closers
+}
+
+// blankLoneAsterisks replaces each * with space on both sides, like a list bullet
+// or a plain asterisk, with a space so it isn't counted as italics.
+func blankLoneAsterisks(s string) string {
+    b := []byte(s)
+    for i := range b {
+        if b[i] != '*' {
+            continue
+        }
+        before, _ := utf8.DecodeLastRuneInString(s[:i])
+        after, _ := utf8.DecodeRuneInString(s[i+1:])
+        if (i == 0 || unicode.IsSpace(before)) && (i+1 == len(s) || unicode.IsSpace(after)) {
+            b[i] = ' '
+        }
+    }
+    return string(b)
+}
+
+// SplitMessage breaks body into messages of at most maxLen characters,
+// preferring paragraph, then line, then word boundaries.
+// Code blocks cut between two messages are closed and reopened.
+func SplitMessage(body string, maxLen int) []string {
+    chunks := []string{}
+    body = strings.TrimSpace(body)
+    for textLength(body) > maxLen {
+        chunk, rest := splitChunk(body, maxLen)
+        if len(rest) >= len(body) {
+            // The fences left no room for any text, cut it as is so every chunk takes some of it.
+            chunk, _ = cutGraphemes(body, maxLen)
+            if chunk == "" {
+                chunk, _, _, _ = uniseg.FirstGraphemeClusterInString(body, -1)
+            }
+            rest = strings.TrimLeftFunc(body[len(chunk):], unicode.IsSpace)
+        }
+        chunks = append(chunks, chunk)
+        body = rest
+    }
+    if body != "" {
+        chunks = append(chunks, body)
+    }
+    return chunks
+}
+
+// splitChunk takes the first message off body, closing a code block it cuts through
+// and reopening it at the start of the rest.
+func splitChunk(body string, maxLen int) (chunk string, rest string) {
+    fence := "```"
+    cut := splitPoint(body, maxLen-textLength("\n"+fence))
+    chunk = strings.TrimRightFunc(body[:cut], unicode.IsSpace)
+    rest = strings.TrimLeftFunc(body[cut:], unicode.IsSpace)
+    if idx := strings.LastIndex(chunk, fence); idx > 0 && strings.Count(chunk, fence)%2 == 1 &&
+        !strings.Contains(strings.TrimSpace(chunk[idx+len(fence):]), "\n") {
+        // Cut just after a block opens, so the whole block moves to the next chunk.
+        rest = chunk[idx:] + "\n" + rest
+        chunk = strings.TrimRightFunc(chunk[:idx], unicode.IsSpace)
+    }
+    if strings.Count(chunk, fence)%2 == 1 {
+        chunk += "\n" + fence
+        if strings.HasPrefix(rest, fence) {
+            // Cut just before the block's own closing fence, which the chunk now has.
+            rest = strings.TrimLeftFunc(rest[len(fence):], unicode.IsSpace)
+        } else {
+            rest = fence + "\n" + rest
+        }
+    }
+    return chunk, rest
+}
+
+// splitPoint finds the byte offset to split body at so the first part fits in limit characters.
+func splitPoint(body string, limit int) int {
+    prefix, _ := cutGraphemes(body, limit)
+    if prefix == "" {
+        cluster, _, _, _ := uniseg.FirstGraphemeClusterInString(body, -1)
+        return len(cluster)
+    }
+    for _, sep := range []string{"\n\n", "\n"} {
+        if idx := strings.LastIndex(prefix, sep); idx > 0 && idx >= len(prefix)/3 {
+            return idx
+        }
+    }
+    if idx := strings.LastIndexFunc(prefix, unicode.IsSpace); idx > 0 && idx >= len(prefix)/2 {
+        return idx
+    }
+    return len(prefix)
+}
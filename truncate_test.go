@@ -0,0 +1,126 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSplitMessage(t *testing.T) {
+    tests := []struct {
+        name string
+        body string
+        maxLen int
+        want []string
+    }{
+        {"fits", "short body", 30, []string{"short body"}},
+        {"paragraphs", "first paragraph here\n\nsecond paragraph", 30, []string{"first paragraph here", "second paragraph"}},
+        {"graphemes", "👍🏽👍🏽👍🏽", 4, []string{"👍🏽", "👍🏽👍🏽"}},
+        {
+            "code block reopened",
+            "intro text\n```\nline one\nline two\nline three\n```\nafter",
+            30,
+            []string{"intro text", "```\nline one\nline two\n```", "```\nline three\n```\nafter"},
+        },
+        {
+            "cut before closing fence",
+            "some words here\n```\ncode code\n```\nafter the block ends",
+            31,
+            []string{"some words here", "```\ncode code\n```", "after the block ends"},
+        },
+        {
+            "cut after opening fence",
+            "a few words of intro\n```go\nfunc main() {}\n```",
+            28,
+            []string{"a few words of intro", "```go\nfunc main() {}\n```"},
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got := SplitMessage(tt.body, tt.maxLen)
+            if !slices.Equal(got, tt.want) {
+                t.Fatalf("SplitMessage(%q, %d)\n got %q\nwant %q", tt.body, tt.maxLen, got, tt.want)
+            }
+        })
+    }
+}
+
+// Limits too small for a reopened code block used to loop forever.
+func TestSplitMessageTinyLimits(t *testing.T) {
+    bodies := []string{
+        "x ```" + strings.Repeat("y", 50),
+        "```\n" + strings.Repeat("z", 40) + "\n```",
+        "words before\n```\n" + strings.Repeat("code\n", 10) + "```\nwords after",
+    }
+    for _, body := range bodies {
+        for maxLen := 1; maxLen <= 40; maxLen++ {
+            chunks := SplitMessage(body, maxLen)
+            for _, chunk := range chunks {
+                if textLength(chunk) > maxLen {
+                    t.Fatalf("SplitMessage(%q, %d) made a %d character chunk %q", body, maxLen, textLength(chunk), chunk)
+                }
+            }
+            if maxLen >= MinMessageLength && strings.Contains(strings.Join(chunks, "|"), "```\n```") {
+                t.Fatalf("SplitMessage(%q, %d) made an empty code block: %q", body, maxLen, chunks)
+            }
+        }
+    }
+}
+
+func TestTruncateString(t *testing.T) {
+    tests := []struct {
+        name string
+        body string
+        maxLen int
+        want string
+    }{
+        {"fits", "short", 10, "short"},
+        {"word boundary", "one two three four", 12, "one two..."},
+        {"graphemes", "👍🏽👍🏽👍🏽👍🏽👍🏽", 7, "👍🏽👍🏽..."},
+        {"no room for suffix", "abcdef", 3, "abc"},
+        {"link dropped", "see [the link](https://example.com/a) and more", 20, "see..."},
+        {"whole link kept", "[a](https://x.io) and more text", 22, "[a](https://x.io)..."},
+        {"code span dropped", "some `inline code here` and more", 18, "some..."},
+        {"code block dropped", "intro\n```\ncode that goes on\n```", 20, "intro..."},
+        {"italics closed", "some *italic text that goes on", 20, "some *italic*..."},
+        {"bold closed", "**bold text that goes on and on**", 20, "**bold text**..."},
+        {"bullets", "* bullet one\n* bullet two", 15, "* bullet one..."},
+        {"plain asterisks", "a * b * c and some more words", 12, "a * b * c..."},
+        {"closed italics", "*a* b and then words", 8, "*a* b..."},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got := truncateString(tt.body, tt.maxLen)
+            if got != tt.want {
+                t.Fatalf("truncateString(%q, %d) = %q, want %q", tt.body, tt.maxLen, got, tt.want)
+            }
+            if textLength(got) > tt.maxLen {
+                t.Fatalf("truncateString(%q, %d) is %d characters long", tt.body, tt.maxLen, textLength(got))
+            }
+        })
+    }
+}
+
+func TestCloseMarkdown(t *testing.T) {
+    tests := []struct {
+        in string
+        want string
+    }{
+        {"plain text", "plain text"},
+        {"open *italic", "open *italic*"},
+        {"open **bold and *both", "open **bold and *both***"},
+        {"~~struck", "~~struck~~"},
+        {"||spoiler", "||spoiler||"},
+        {"dangling **", "dangling"},
+        {"* bullet\n* another", "* bullet\n* another"},
+        {"3 * 4 = 12", "3 * 4 = 12"},
+        {"text `code", "text"},
+        {"see [partial](http", "see"},
+        {"```\ncode\n``` after *it", "```\ncode\n``` after *it*"},
+    }
+    for _, tt := range tests {
+        if got := closeMarkdown(tt.in); got != tt.want {
+            t.Errorf("closeMarkdown(%q) = %q, want %q", tt.in, got, tt.want)
+        }
+    }
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/robfig/cron/v3"
+)
+
+// cronParser matches how gocron parses a CronJob with seconds.
+var cronParser = cron.NewParser(cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// Thread auto archive durations discord accepts, in minutes. 0 uses the channel's default.
+var validArchiveDurations = []int{0, 60, 1440, 4320, 10080}
+
+// ValidationError lists every problem found in a config.
+type ValidationError struct {
+    Problems []string
+}
+
+func (e *ValidationError) Error() string {
+    return "invalid config:\n  " + strings.Join(e.Problems, "\n  ")
+}
+
+type validator struct {
+    problems []string
+}
+
+func (v *validator) add(path string, format string, args ...any) {
+    v.problems = append(v.problems, path+": "+fmt.Sprintf(format, args...))
+}
+
+// Validate checks a normalized config, reporting all problems at once with the
+// path of the setting at fault. The legacy [Feed] is Feeds[0] and [DiscordServer] is Guilds[0].
+func (c *Config) Validate() error {
+    v := &validator{}
+    if c.DiscordBot.Token == "" {
+        v.add("DiscordBot.Token", "is required")
+    }
+    if c.DiscordBot.Logging > LogDebug {
+        v.add("DiscordBot.Logging", "must be 0 (none), 1 (prod) or 2 (debug), got %d", c.DiscordBot.Logging)
+    }
+    if c.DiscordBot.Retries < 0 {
+        v.add("DiscordBot.Retries", "can't be negative")
+    }
+    if c.Discord.MaxTitleLength < 1 || c.Discord.MaxTitleLength > 100 {
+        v.add("Discord.MaxTitleLength", "must be between 1 and 100, got %d", c.Discord.MaxTitleLength)
+    }
+    if c.Discord.MaxMessageLength < MinMessageLength || c.Discord.MaxMessageLength > 2000 {
+        v.add("Discord.MaxMessageLength", "must be between %d and 2000, got %d", MinMessageLength, c.Discord.MaxMessageLength)
+    }
+
+    if len(c.Feeds) == 0 {
+        v.add("Feeds", "no feeds configured, set [Feed] Url or add a [[Feeds]] table")
+    }
+    names := make(map[string]bool, len(c.Feeds))
+    for x := range c.Feeds {
+        c.validateFeed(v, fmt.Sprintf("Feeds[%d]", x), &c.Feeds[x])
+        if names[c.Feeds[x].Name] {
+            v.add(fmt.Sprintf("Feeds[%d].Name", x), "'%s' is used by more than one feed", c.Feeds[x].Name)
+        }
+        names[c.Feeds[x].Name] = true
+    }
+
+    if len(c.Guilds) == 0 {
+        v.add("Guilds", "no guilds configured, set [DiscordServer] GuildID or add a [[Guilds]] table")
+    }
+    guilds := make(map[string]bool, len(c.Guilds))
+    for x := range c.Guilds {
+        g := &c.Guilds[x]
+        path := fmt.Sprintf("Guilds[%d]", x)
+        if g.GuildID == "" {
+            v.add(path+".GuildID", "is required")
+        } else if guilds[g.GuildID] {
+            v.add(path+".GuildID", "'%s' is configured more than once", g.GuildID)
+        }
+        guilds[g.GuildID] = true
+        for y, sub := range g.Feeds {
+            subPath := fmt.Sprintf("%s.Feeds[%d]", path, y)
+            if !names[sub.Name] {
+                v.add(subPath+".Name", "there is no feed named '%s'", sub.Name)
+            }
+            if sub.PostChannelID == "" {
+                v.add(subPath+".PostChannelID", "is required, set it here or on the guild")
+            }
+        }
+    }
+
+    switch c.State.Type {
+    case "", StateJSON, StateBolt:
+    default:
+        v.add("State.Type", "must be '%s' or '%s', got '%s'", StateJSON, StateBolt, c.State.Type)
+    }
+    if c.Fetch.Timeout < 0 {
+        v.add("Fetch.Timeout", "can't be negative")
+    }
+    if c.Fetch.MaxBodyBytes < 0 {
+        v.add("Fetch.MaxBodyBytes", "can't be negative")
+    }
+    if c.Fetch.Retries < 0 {
+        v.add("Fetch.Retries", "can't be negative")
+    }
+    if c.Fetch.RetryDelay < 0 {
+        v.add("Fetch.RetryDelay", "can't be negative")
+    }
+    if c.StatusServer.Listen != "" {
+        if _, _, err := net.SplitHostPort(c.StatusServer.Listen); err != nil {
+            v.add("StatusServer.Listen", "%v", err)
+        }
+    }
+    for name := range c.Permissions {
+        if _, ok := commandHandlers[name]; !ok {
+            v.add("Permissions."+name, "there is no '%s' command", name)
+        }
+    }
+
+    if len(v.problems) > 0 {
+        return &ValidationError{Problems: v.problems}
+    }
+    return nil
+}
+
+func (c *Config) validateFeed(v *validator, path string, f *FeedConfig) {
+    if f.Url == "" {
+        v.add(path+".Url", "is required")
+    } else if u, err := url.Parse(f.Url); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+        v.add(path+".Url", "'%s' is not an http(s) url", f.Url)
+    }
+    if _, err := cronParser.Parse(f.CronSchedule); err != nil {
+        v.add(path+".CronSchedule", "'%s' isn't a 6 field cron schedule starting with seconds: %v", f.CronSchedule, err)
+    }
+    if f.PostInterval < 0 {
+        v.add(path+".PostInterval", "can't be negative")
+    }
+    switch f.Description {
+    case "", DescriptionMarkdown, DescriptionText, DescriptionRaw:
+    default:
+        v.add(path+".Description", "must be '%s', '%s' or '%s', got '%s'", DescriptionMarkdown, DescriptionText, DescriptionRaw, f.Description)
+    }
+    if !slices.Contains(validArchiveDurations, f.DiscordMsg.ArchiveDuration) {
+        v.add(path+".DiscordMsg.ArchiveDuration", "must be one of %v minutes, got %d", validArchiveDurations, f.DiscordMsg.ArchiveDuration)
+    }
+    if _, err := ParseMsgTemplates(f.DiscordMsg); err != nil {
+        v.add(path+".DiscordMsg", "%v", err)
+    }
+    if !slices.Contains(feedTypes, strings.ToLower(f.Type)) {
+        v.add(path+".Type", "must be one of %s, got '%s'", strings.Join(feedTypes[1:], ", "), f.Type)
+    } else if strings.ToLower(f.Type) == FeedTypeScrape {
+        if _, err := newScrapeSource(f.Url, f.Scrape); err != nil {
+            v.add(path+".Scrape", "%v", err)
+        }
+    }
+    if _, err := NewItemFilter(f.Filter); err != nil {
+        v.add(path+".Filter", "%v", err)
+    }
+}
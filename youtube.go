@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net/url"
+	"strconv"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// YouTubeVideo is what YouTube's videos.xml says about an item, as .YouTube in the templates.
+type YouTubeVideo struct {
+    VideoID string
+    ChannelID string
+    // URL is ShortsURL for Shorts and WatchURL for everything else.
+    URL string
+    WatchURL string
+    ShortsURL string
+    IsShort bool
+    Thumbnail string
+    // Description is the plain text media:description.
+    Description string
+    Views int64
+    // Rating is the average star rating out of RatingMax, from RatingCount votes.
+    Rating float64
+    RatingCount int64
+    RatingMax int
+}
+
+// youTubeSource reads the yt: and media: extensions of a YouTube channel or playlist feed.
+type youTubeSource struct{}
+
+// Parse points each item at its canonical watch or Shorts url, and falls back to the
+// media description and thumbnail when the entry has no summary or image of its own.
+func (youTubeSource) Parse(body []byte) (*gofeed.Feed, error) {
+    feed, err := parseFeedAs(FeedTypeAtom, body)
+    if err != nil {
+        return nil, err
+    }
+    for _, item := range feed.Items {
+        video := youTubeVideo(item)
+        if video.VideoID != "" {
+            item.Link = video.URL
+            item.Links = []string{video.URL}
+        }
+        if item.Description == "" {
+            item.Description = video.Description
+        }
+        if item.Image == nil && video.Thumbnail != "" {
+            item.Image = &gofeed.Image{URL: video.Thumbnail}
+        }
+    }
+    return feed, nil
+}
+
+func (youTubeSource) Extend(data *TemplateData) {
+    data.YouTube = youTubeVideo(data.Item)
+}
+
+func youTubeVideo(item *gofeed.Item) *YouTubeVideo {
+    video := &YouTubeVideo{
+        VideoID: extensionValue(item, "yt", "videoId"),
+        ChannelID: extensionValue(item, "yt", "channelId"),
+        IsShort: isYouTubeShort(item),
+        Thumbnail: itemThumbnail(item),
+        Description: extensionValue(item, "media", "description"),
+    }
+    if video.VideoID != "" {
+        video.WatchURL = "https://www.youtube.com/watch?v=" + url.QueryEscape(video.VideoID)
+        video.ShortsURL = "https://www.youtube.com/shorts/" + url.PathEscape(video.VideoID)
+    }
+    video.URL = video.WatchURL
+    if video.IsShort {
+        video.URL = video.ShortsURL
+    }
+    if community := extension(item, "media", "community"); community != nil {
+        if stats := community.Children["statistics"]; len(stats) > 0 {
+            video.Views, _ = strconv.ParseInt(stats[0].Attrs["views"], 10, 64)
+        }
+        if rating := community.Children["starRating"]; len(rating) > 0 {
+            video.Rating, _ = strconv.ParseFloat(rating[0].Attrs["average"], 64)
+            video.RatingCount, _ = strconv.ParseInt(rating[0].Attrs["count"], 10, 64)
+            video.RatingMax, _ = strconv.Atoi(rating[0].Attrs["max"])
+        }
+    }
+    return video
+}